@@ -0,0 +1,238 @@
+package rtfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	ipfsapi "github.com/RTradeLtd/go-ipfs-api/v3"
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+// symlink policies
+const (
+	// SymlinksPreserve adds symlinks as UnixFS symlinks
+	SymlinksPreserve = iota
+	// SymlinksFollow adds the files and directories symlinks point to
+	SymlinksFollow
+	// SymlinksSkip leaves symlinks out
+	SymlinksSkip
+)
+
+// AddProgress reports the progress of an add
+type AddProgress struct {
+	// Bytes is the number of bytes sent to the node so far
+	Bytes int64
+	// Files is the number of files sent in full so far
+	Files int
+	// Path is the file currently being sent, relative to the directory added
+	Path string
+}
+
+// AddDirOpts is used to control how a directory is added
+type AddDirOpts struct {
+	// Exclude holds .gitignore style patterns, matched against slash separated
+	// paths relative to the directory being added
+	Exclude []string
+	// ExcludeFile is the path of a file holding further exclude patterns, such as a .gitignore
+	ExcludeFile string
+	// Hidden includes files and directories whose names begin with a dot
+	Hidden bool
+	// Symlinks is one of SymlinksPreserve, SymlinksFollow or SymlinksSkip
+	Symlinks int
+	// AddOpts are applied to the add request, as with Add
+	AddOpts []ipfsapi.AddOpts
+	// Progress is called as data is sent to the node, from a single goroutine at a time
+	Progress func(AddProgress)
+}
+
+// Chunker is used to select the chunking algorithm used when adding data,
+// such as "size-262144" or "rabin-262144-524288-1048576"
+func Chunker(chunker string) ipfsapi.AddOpts {
+	return func(rb *ipfsapi.RequestBuilder) error {
+		rb.Option("chunker", chunker)
+		return nil
+	}
+}
+
+// WrapWithDirectory is used to wrap the added content in a directory,
+// whose hash is returned instead
+func WrapWithDirectory(enabled bool) ipfsapi.AddOpts {
+	return func(rb *ipfsapi.RequestBuilder) error {
+		rb.Option("wrap-with-directory", enabled)
+		return nil
+	}
+}
+
+// progressTracker accumulates progress across every file in an add
+type progressTracker struct {
+	mux      sync.Mutex
+	progress AddProgress
+	report   func(AddProgress)
+}
+
+func (p *progressTracker) read(path string, n int, eof bool) {
+	if p == nil {
+		return
+	}
+	p.mux.Lock()
+	p.progress.Bytes += int64(n)
+	p.progress.Path = path
+	if eof {
+		p.progress.Files++
+	}
+	progress := p.progress
+	p.mux.Unlock()
+	p.report(progress)
+}
+
+// trackedReader reports progress as it is read, opening its source on the first
+// read and closing it once exhausted, so that only one file is open at a time
+type trackedReader struct {
+	path    string
+	open    func() (io.ReadCloser, error)
+	tracker *progressTracker
+
+	r    io.ReadCloser
+	done bool
+}
+
+func (t *trackedReader) Read(p []byte) (int, error) {
+	if t.done {
+		return 0, io.EOF
+	}
+	if t.r == nil {
+		r, err := t.open()
+		if err != nil {
+			return 0, err
+		}
+		t.r = r
+	}
+	n, err := t.r.Read(p)
+	if err == io.EOF {
+		t.done = true
+		t.r.Close()
+	}
+	t.tracker.read(t.path, n, t.done)
+	return n, err
+}
+
+func (t *trackedReader) Close() error {
+	if t.r == nil || t.done {
+		return nil
+	}
+	t.done = true
+	return t.r.Close()
+}
+
+// newTrackedFile returns a file whose content is read from open when first needed
+func newTrackedFile(path string, open func() (io.ReadCloser, error), tracker *progressTracker) files.File {
+	return files.NewReaderFile(&trackedReader{path: path, open: open, tracker: tracker})
+}
+
+// dirWalker builds the directories sent to the node, applying the add options
+type dirWalker struct {
+	opts    AddDirOpts
+	rules   ignoreRules
+	tracker *progressTracker
+}
+
+func newDirWalker(opts AddDirOpts) (*dirWalker, error) {
+	if opts.Symlinks < SymlinksPreserve || opts.Symlinks > SymlinksSkip {
+		return nil, errors.New("invalid symlink policy")
+	}
+	patterns := opts.Exclude
+	if opts.ExcludeFile != "" {
+		data, err := ioutil.ReadFile(opts.ExcludeFile)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(append([]string{}, patterns...), strings.Split(string(data), "\n")...)
+	}
+	rules, err := compileIgnoreRules(patterns)
+	if err != nil {
+		return nil, err
+	}
+	w := &dirWalker{opts: opts, rules: rules}
+	if opts.Progress != nil {
+		w.tracker = &progressTracker{report: opts.Progress}
+	}
+	return w, nil
+}
+
+// dir lists the entries of the local directory at abs, whose path relative
+// to the root is rel. ancestors holds the real paths of the directories
+// above it, so that followed symlinks can not loop forever
+func (w *dirWalker) dir(abs, rel string, ancestors []string) (files.Directory, error) {
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+	for _, ancestor := range ancestors {
+		if ancestor == real {
+			return nil, fmt.Errorf("symlink loop at '%s'", abs)
+		}
+	}
+	ancestors = append(ancestors, real)
+	infos, err := ioutil.ReadDir(abs)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	entries := make([]files.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		name := info.Name()
+		childAbs := filepath.Join(abs, name)
+		childRel := name
+		if rel != "" {
+			childRel = rel + "/" + name
+		}
+		if !w.opts.Hidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			switch w.opts.Symlinks {
+			case SymlinksSkip:
+				continue
+			case SymlinksPreserve:
+				if w.rules.excluded(childRel, false) {
+					continue
+				}
+				target, err := os.Readlink(childAbs)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, files.FileEntry(name, files.NewLinkFile(target, info)))
+				continue
+			}
+			if info, err = os.Stat(childAbs); err != nil {
+				return nil, err
+			}
+		}
+		if w.rules.excluded(childRel, info.IsDir()) {
+			continue
+		}
+		var node files.Node
+		switch {
+		case info.IsDir():
+			if node, err = w.dir(childAbs, childRel, ancestors); err != nil {
+				return nil, err
+			}
+		case info.Mode().IsRegular():
+			node = newTrackedFile(childRel, func() (io.ReadCloser, error) {
+				return os.Open(childAbs)
+			}, w.tracker)
+		default:
+			// devices, sockets and pipes can not be added
+			continue
+		}
+		entries = append(entries, files.FileEntry(name, node))
+	}
+	return files.NewSliceDirectory(entries), nil
+}
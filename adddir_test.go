@@ -0,0 +1,208 @@
+package rtfs_test
+
+import (
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	ipfsapi "github.com/RTradeLtd/go-ipfs-api/v3"
+	"github.com/RTradeLtd/rtfs/v2"
+)
+
+// newFakeAddNode returns a manager whose node records the paths of the files and
+// directories added, keyed by path, with "dir" for directories and the target of symlinks
+func newFakeAddNode(t *testing.T, added map[string]string) *rtfs.IpfsManager {
+	return newFakeNode(t, map[string]http.HandlerFunc{
+		"add": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("recursive") != "true" {
+				t.Error("add was not recursive")
+			}
+			for option, value := range map[string]string{"pin": "false", "chunker": "size-1024"} {
+				if got := r.URL.Query().Get(option); got != "" && got != value {
+					t.Errorf("option %s = %s, want %s", option, got, value)
+				}
+			}
+			mr, err := r.MultipartReader()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for {
+				part, err := mr.NextPart()
+				if err != nil {
+					break
+				}
+				_, params, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+				name, _ := url.QueryUnescape(params["filename"])
+				data, _ := ioutil.ReadAll(part)
+				switch part.Header.Get("Content-Type") {
+				case "application/x-directory":
+					added[name] = "dir"
+				case "application/symlink":
+					added[name] = "-> " + string(data)
+				default:
+					added[name] = string(data)
+				}
+			}
+			w.Write([]byte(`{"Name":"root","Bytes":5}` + "\n" + `{"Name":"root","Hash":"` + testPIN + `"}` + "\n"))
+		},
+	})
+}
+
+func writeTestTree(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "rtfs-adddir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	root := filepath.Join(dir, "project")
+	for name, content := range map[string]string{
+		"readme.md":           "hello",
+		".env":                "secret",
+		"debug.log":           "log",
+		"keep.log":            "kept",
+		"build/out.bin":       "binary",
+		"src/main.go":         "package main",
+		"src/vendor/lib.go":   "package lib",
+		"docs/a/b/deep.md":    "deep",
+		"docs/.cache/data":    "cache",
+		"node_modules/mod.js": "module",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "ignore"), []byte("# comment\nnode_modules/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("readme.md", filepath.Join(root, "link.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..", filepath.Join(root, "docs", "parent")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestAddDirWithOptions(t *testing.T) {
+	root := writeTestTree(t)
+	tests := []struct {
+		name    string
+		opts    rtfs.AddDirOpts
+		want    []string
+		wantErr bool
+	}{
+		{"Excludes", rtfs.AddDirOpts{
+			Exclude:     []string{"*.log", "!keep.log", "/build", "src/**/lib.go", "docs/*/b/"},
+			ExcludeFile: filepath.Join(filepath.Dir(root), "ignore"),
+			Symlinks:    rtfs.SymlinksSkip,
+			AddOpts:     []ipfsapi.AddOpts{ipfsapi.Pin(false), rtfs.Chunker("size-1024")},
+		}, []string{"project", "project/docs", "project/docs/a", "project/keep.log", "project/readme.md",
+			"project/src", "project/src/main.go", "project/src/vendor"}, false},
+		{"Hidden", rtfs.AddDirOpts{
+			Exclude:  []string{"node_modules", "build", "src", "docs/a", "*.log", "*.md"},
+			Hidden:   true,
+			Symlinks: rtfs.SymlinksSkip,
+		}, []string{"project", "project/.env", "project/docs", "project/docs/.cache", "project/docs/.cache/data"}, false},
+		{"Preserve-Symlinks", rtfs.AddDirOpts{
+			Exclude: []string{"node_modules", "build", "src", "docs/a", "*.log"},
+		}, []string{"project", "project/docs", "project/docs/parent", "project/link.md", "project/readme.md"}, false},
+		{"Follow-Symlink-Loop", rtfs.AddDirOpts{Symlinks: rtfs.SymlinksFollow}, nil, true},
+		{"Invalid-Pattern", rtfs.AddDirOpts{Exclude: []string{"[z-a]"}}, nil, true},
+		{"Invalid-Symlink-Policy", rtfs.AddDirOpts{Symlinks: 7}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added := make(map[string]string)
+			im := newFakeAddNode(t, added)
+			hash, err := im.AddDirWithOptions(root, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddDirWithOptions() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if hash != testPIN {
+				t.Fatalf("AddDirWithOptions() = %v, want %v", hash, testPIN)
+			}
+			var got []string
+			for name := range added {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("added %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddDirWithOptions_Symlinks(t *testing.T) {
+	root := writeTestTree(t)
+	// remove the loop so links can be followed
+	if err := os.Remove(filepath.Join(root, "docs", "parent")); err != nil {
+		t.Fatal(err)
+	}
+	added := make(map[string]string)
+	var progress []rtfs.AddProgress
+	im := newFakeAddNode(t, added)
+	if _, err := im.AddDirWithOptions(root, rtfs.AddDirOpts{
+		Exclude:  []string{"node_modules", "build", "src", "docs", "*.log"},
+		Symlinks: rtfs.SymlinksFollow,
+		Progress: func(p rtfs.AddProgress) { progress = append(progress, p) },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if added["project/link.md"] != "hello" {
+		t.Fatalf("followed symlink added as %q", added["project/link.md"])
+	}
+	last := progress[len(progress)-1]
+	if last.Files != 2 || last.Bytes != 10 {
+		t.Fatalf("final progress = %+v, want 2 files and 10 bytes", last)
+	}
+
+	added = make(map[string]string)
+	im = newFakeAddNode(t, added)
+	if _, err := im.AddDirWithOptions(root, rtfs.AddDirOpts{Exclude: []string{"*", "!link.md"}}); err != nil {
+		t.Fatal(err)
+	}
+	if added["project/link.md"] != "-> readme.md" {
+		t.Fatalf("preserved symlink added as %q", added["project/link.md"])
+	}
+	if _, err := im.AddDirWithOptions(filepath.Join(root, "readme.md"), rtfs.AddDirOpts{}); err == nil {
+		t.Fatal("expected error adding a file")
+	}
+}
+
+func TestAddDirWithOptions_Node(t *testing.T) {
+	im, err := rtfs.NewManager(nodeOneAPIAddr, "", time.Minute*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := writeTestTree(t)
+	hash, err := im.AddDirWithOptions(root, rtfs.AddDirOpts{
+		Exclude: []string{"node_modules/"},
+		AddOpts: []ipfsapi.AddOpts{ipfsapi.CidVersion(1), rtfs.WrapWithDirectory(true)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := im.DagLinks(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].Name != "project" {
+		t.Fatal("directory was not wrapped")
+	}
+}
@@ -0,0 +1,196 @@
+package rtfs
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+// AddEntry is a file added by AddReaders
+type AddEntry struct {
+	// Path is the slash separated path of the file within the directory, such as "docs/readme.md"
+	Path string
+	// Reader holds the content of the file. If it is an io.ReadCloser, it is closed
+	// once read, or when the add fails
+	Reader io.Reader
+}
+
+// virtualDir is a directory assembled from entries that do not exist on disk
+type virtualDir struct {
+	dirs  map[string]*virtualDir
+	files map[string]files.Node
+}
+
+func newVirtualDir() *virtualDir {
+	return &virtualDir{dirs: make(map[string]*virtualDir), files: make(map[string]files.Node)}
+}
+
+// add places a file at the slash separated path p, creating parent directories as needed
+func (d *virtualDir) add(p string, node files.Node) error {
+	segments := strings.Split(p, "/")
+	dir := d
+	for _, segment := range segments[:len(segments)-1] {
+		if _, ok := dir.files[segment]; ok {
+			return fmt.Errorf("'%s' in '%s' is not a directory", segment, p)
+		}
+		child, ok := dir.dirs[segment]
+		if !ok {
+			child = newVirtualDir()
+			dir.dirs[segment] = child
+		}
+		dir = child
+	}
+	name := segments[len(segments)-1]
+	if _, ok := dir.dirs[name]; ok {
+		return fmt.Errorf("'%s' is a directory", p)
+	} else if _, ok := dir.files[name]; ok {
+		return fmt.Errorf("duplicate path '%s'", p)
+	}
+	dir.files[name] = node
+	return nil
+}
+
+// directory converts the tree into a directory, with entries sorted by name
+func (d *virtualDir) directory() files.Directory {
+	entries := make([]files.DirEntry, 0, len(d.dirs)+len(d.files))
+	for name, dir := range d.dirs {
+		entries = append(entries, files.FileEntry(name, dir.directory()))
+	}
+	for name, file := range d.files {
+		entries = append(entries, files.FileEntry(name, file))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return files.NewSliceDirectory(entries)
+}
+
+// newReaderDirectory builds a directory from entries. Entries which are hidden or
+// excluded by opts are left out, and their readers closed if possible
+func newReaderDirectory(entries []AddEntry, opts AddDirOpts) (files.Directory, error) {
+	walker, err := newDirWalker(opts)
+	if err != nil {
+		return nil, err
+	}
+	root := newVirtualDir()
+	for _, entry := range entries {
+		p := strings.Trim(entry.Path, "/")
+		if entry.Reader == nil {
+			return nil, fmt.Errorf("no reader given for '%s'", entry.Path)
+		}
+		for _, segment := range strings.Split(p, "/") {
+			if segment == "" || segment == "." || segment == ".." {
+				return nil, fmt.Errorf("invalid path '%s'", entry.Path)
+			}
+		}
+		if walker.hidden(p) || walker.excludedPath(p) {
+			if closer, ok := entry.Reader.(io.Closer); ok {
+				closer.Close()
+			}
+			continue
+		}
+		reader := entry.Reader
+		file := newTrackedFile(p, func() (io.ReadCloser, error) {
+			if rc, ok := reader.(io.ReadCloser); ok {
+				return rc, nil
+			}
+			return ioutil.NopCloser(reader), nil
+		}, walker.tracker)
+		if err := root.add(p, file); err != nil {
+			return nil, err
+		}
+	}
+	return root.directory(), nil
+}
+
+// closeEntries is used to close the reader of every entry that is an io.Closer,
+// so that readers are not leaked when an add fails part way through
+func closeEntries(entries []AddEntry) {
+	for _, entry := range entries {
+		if closer, ok := entry.Reader.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+// fsDir lists the entries of the directory at p within fsys. fs.FS provides no way to
+// read symlink targets, so symlinks are only added when they are followed
+func (w *dirWalker) fsDir(fsys fs.FS, p string, depth int) (files.Directory, error) {
+	if depth > maxFSDepth {
+		return nil, fmt.Errorf("directory nesting at '%s' is too deep, is there a symlink loop?", p)
+	}
+	dirEntries, err := fs.ReadDir(fsys, p)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]files.DirEntry, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		childPath := path.Join(p, name)
+		if !w.opts.Hidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		isDir := dirEntry.IsDir()
+		mode := dirEntry.Type()
+		if mode&fs.ModeSymlink != 0 {
+			if w.opts.Symlinks != SymlinksFollow {
+				continue
+			}
+			info, err := fs.Stat(fsys, childPath)
+			if err != nil {
+				return nil, err
+			}
+			isDir, mode = info.IsDir(), info.Mode().Type()
+		}
+		if w.rules.excluded(childPath, isDir) {
+			continue
+		}
+		var node files.Node
+		switch {
+		case isDir:
+			if node, err = w.fsDir(fsys, childPath, depth+1); err != nil {
+				return nil, err
+			}
+		case mode.IsRegular():
+			node = newTrackedFile(childPath, func() (io.ReadCloser, error) {
+				return fsys.Open(childPath)
+			}, w.tracker)
+		default:
+			continue
+		}
+		entries = append(entries, files.FileEntry(name, node))
+	}
+	return files.NewSliceDirectory(entries), nil
+}
+
+// maxFSDepth limits directory nesting when adding an fs.FS, as symlink
+// loops can not be detected without access to the underlying paths
+const maxFSDepth = 256
+
+// hidden returns whether or not any segment of the slash separated path p is hidden and should be left out
+func (w *dirWalker) hidden(p string) bool {
+	if w.opts.Hidden {
+		return false
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedPath returns whether or not the file at p, or any directory above it, is excluded
+func (w *dirWalker) excludedPath(p string) bool {
+	segments := strings.Split(p, "/")
+	for i := 1; i < len(segments); i++ {
+		if w.rules.excluded(strings.Join(segments[:i], "/"), true) {
+			return true
+		}
+	}
+	return w.rules.excluded(p, false)
+}
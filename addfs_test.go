@@ -0,0 +1,150 @@
+package rtfs_test
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/RTradeLtd/rtfs/v2"
+)
+
+// closeTracker records whether it has been closed
+type closeTracker struct {
+	*bytes.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestAddReaders(t *testing.T) {
+	excluded := &closeTracker{Reader: bytes.NewReader([]byte("excluded"))}
+	read := &closeTracker{Reader: bytes.NewReader([]byte("closed"))}
+	tests := []struct {
+		name    string
+		dir     string
+		entries []rtfs.AddEntry
+		opts    rtfs.AddDirOpts
+		want    map[string]string
+		wantErr bool
+	}{
+		{"Tree", "upload", []rtfs.AddEntry{
+			{Path: "docs/readme.md", Reader: strings.NewReader("hello")},
+			{Path: "/index.html", Reader: read},
+			{Path: "docs/guides/intro.md", Reader: strings.NewReader("intro")},
+			{Path: ".env", Reader: strings.NewReader("secret")},
+			{Path: "tmp/cache.bin", Reader: excluded},
+		}, rtfs.AddDirOpts{Exclude: []string{"tmp/"}}, map[string]string{
+			"upload":                      "dir",
+			"upload/docs":                 "dir",
+			"upload/docs/guides":          "dir",
+			"upload/docs/guides/intro.md": "intro",
+			"upload/docs/readme.md":       "hello",
+			"upload/index.html":           "closed",
+		}, false},
+		{"Duplicate", "upload", []rtfs.AddEntry{
+			{Path: "a", Reader: strings.NewReader("1")},
+			{Path: "/a", Reader: strings.NewReader("2")},
+		}, rtfs.AddDirOpts{}, nil, true},
+		{"File-As-Directory", "upload", []rtfs.AddEntry{
+			{Path: "a", Reader: strings.NewReader("1")},
+			{Path: "a/b", Reader: strings.NewReader("2")},
+		}, rtfs.AddDirOpts{}, nil, true},
+		{"Directory-As-File", "upload", []rtfs.AddEntry{
+			{Path: "a/b", Reader: strings.NewReader("1")},
+			{Path: "a", Reader: strings.NewReader("2")},
+		}, rtfs.AddDirOpts{}, nil, true},
+		{"Invalid-Path", "upload", []rtfs.AddEntry{{Path: "a/../b", Reader: strings.NewReader("1")}}, rtfs.AddDirOpts{}, nil, true},
+		{"No-Reader", "upload", []rtfs.AddEntry{{Path: "a"}}, rtfs.AddDirOpts{}, nil, true},
+		{"No-Name", "", nil, rtfs.AddDirOpts{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added := make(map[string]string)
+			im := newFakeAddNode(t, added)
+			_, err := im.AddReaders(tt.dir, tt.entries, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddReaders() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			checkAdded(t, added, tt.want)
+		})
+	}
+	if !excluded.closed || !read.closed {
+		t.Fatal("readers were not closed")
+	}
+}
+
+func TestAddReaders_CloseOnError(t *testing.T) {
+	first := &closeTracker{Reader: bytes.NewReader([]byte("1"))}
+	second := &closeTracker{Reader: bytes.NewReader([]byte("2"))}
+	im := newFakeAddNode(t, make(map[string]string))
+	if _, err := im.AddReaders("upload", []rtfs.AddEntry{
+		{Path: "a", Reader: first},
+		{Path: "a/../b", Reader: strings.NewReader("invalid")},
+		{Path: "c", Reader: second},
+	}, rtfs.AddDirOpts{}); err == nil {
+		t.Fatal("expected error for invalid path")
+	}
+	if !first.closed || !second.closed {
+		t.Fatal("readers were not closed")
+	}
+}
+
+func TestAddFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"readme.md":        {Data: []byte("hello")},
+		"site/index.html":  {Data: []byte("<html>")},
+		"site/.htaccess":   {Data: []byte("deny")},
+		"site/img/logo.js": {Data: []byte("logo")},
+		"empty":            {Mode: 0755 | 1<<31},
+	}
+	added := make(map[string]string)
+	var files int
+	im := newFakeAddNode(t, added)
+	if _, err := im.AddFS("site", fsys, rtfs.AddDirOpts{
+		Exclude:  []string{"*.js"},
+		Progress: func(p rtfs.AddProgress) { files = p.Files },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	checkAdded(t, added, map[string]string{
+		"site":                 "dir",
+		"site/empty":           "dir",
+		"site/readme.md":       "hello",
+		"site/site":            "dir",
+		"site/site/img":        "dir",
+		"site/site/index.html": "<html>",
+	})
+	if files != 2 {
+		t.Fatalf("progress reported %v files, want 2", files)
+	}
+	if _, err := im.AddFS("", fsys, rtfs.AddDirOpts{}); err == nil {
+		t.Fatal("expected error for empty name")
+	}
+	if _, err := im.AddFS("site", fstest.MapFS{}, rtfs.AddDirOpts{Exclude: []string{"[z-a]"}}); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+}
+
+func checkAdded(t *testing.T, added, want map[string]string) {
+	t.Helper()
+	var got, wanted []string
+	for name, content := range added {
+		got = append(got, name+"="+content)
+	}
+	for name, content := range want {
+		wanted = append(wanted, name+"="+content)
+	}
+	sort.Strings(got)
+	sort.Strings(wanted)
+	if strings.Join(got, ",") != strings.Join(wanted, ",") {
+		t.Fatalf("added %v, want %v", got, wanted)
+	}
+}
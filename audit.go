@@ -0,0 +1,323 @@
+package rtfs
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	datastore "github.com/ipfs/go-datastore"
+	namespace "github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// AuditOperation is the type of operation performed against a key
+type AuditOperation string
+
+// audited operations
+const (
+	// AuditAccess is recorded whenever a private key is handed out
+	AuditAccess AuditOperation = "access"
+	// AuditCreate is recorded whenever a key is saved to the keystore
+	AuditCreate AuditOperation = "create"
+	// AuditExport is recorded whenever a key is exported from the keystore
+	AuditExport AuditOperation = "export"
+	// AuditDelete is recorded whenever a key is removed from the keystore
+	AuditDelete AuditOperation = "delete"
+)
+
+// AuditOutcome is the stage or result of an audited operation
+type AuditOutcome string
+
+// audited outcomes
+const (
+	// AuditAttempt is recorded before an operation is performed, and the
+	// operation is refused if it can not be recorded
+	AuditAttempt AuditOutcome = "attempt"
+	// AuditSuccess is recorded once an operation has succeeded
+	AuditSuccess AuditOutcome = "success"
+	// AuditFailure is recorded once an operation has failed
+	AuditFailure AuditOutcome = "failure"
+)
+
+// AuditEvent is a single audited operation against a key
+type AuditEvent struct {
+	KeyName   string         `json:"key_name"`
+	Operation AuditOperation `json:"operation"`
+	Outcome   AuditOutcome   `json:"outcome"`
+	// Error is the reason the operation failed, if it did
+	Error     string    `json:"error,omitempty"`
+	Principal string    `json:"principal"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AuditQuery is used to filter audit events, empty fields match everything
+type AuditQuery struct {
+	KeyName   string
+	Operation AuditOperation
+	Outcome   AuditOutcome
+	Principal string
+	Since     time.Time
+	Until     time.Time
+}
+
+// Matches returns whether or not the event satisfies the query
+func (q AuditQuery) Matches(ev AuditEvent) bool {
+	switch {
+	case q.KeyName != "" && q.KeyName != ev.KeyName:
+		return false
+	case q.Operation != "" && q.Operation != ev.Operation:
+		return false
+	case q.Outcome != "" && q.Outcome != ev.Outcome:
+		return false
+	case q.Principal != "" && q.Principal != ev.Principal:
+		return false
+	case !q.Since.IsZero() && ev.Timestamp.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && ev.Timestamp.After(q.Until):
+		return false
+	}
+	return true
+}
+
+// AuditSink is used to persist audit events
+type AuditSink interface {
+	Record(ev AuditEvent) error
+}
+
+// AuditQuerier is implemented by audit sinks which can be searched
+type AuditQuerier interface {
+	Query(q AuditQuery) ([]AuditEvent, error)
+}
+
+// KeyUsage contains the usage counters for a single key
+type KeyUsage struct {
+	// Counts is the number of successful operations of each type
+	Counts map[AuditOperation]uint64
+	// Failures is the number of failed operations of each type
+	Failures map[AuditOperation]uint64
+	LastUsed time.Time
+	// Unrecorded is the number of outcomes which could not be written to the audit sink.
+	// Their attempts were recorded, as operations are refused until they are
+	Unrecorded uint64
+}
+
+func newKeyUsage() *KeyUsage {
+	return &KeyUsage{Counts: make(map[AuditOperation]uint64), Failures: make(map[AuditOperation]uint64)}
+}
+
+// auditor records events on behalf of a keystore manager, and
+// is shared between all copies of the manager
+type auditor struct {
+	sink  AuditSink
+	mux   sync.RWMutex
+	usage map[string]*KeyUsage
+}
+
+func newAuditor(sink AuditSink) *auditor {
+	return &auditor{sink: sink, usage: make(map[string]*KeyUsage)}
+}
+
+func (a *auditor) record(keyName string, op AuditOperation, outcome AuditOutcome, opErr error, principal string) error {
+	ev := AuditEvent{
+		KeyName:   keyName,
+		Operation: op,
+		Outcome:   outcome,
+		Principal: principal,
+		Timestamp: time.Now().UTC(),
+	}
+	if opErr != nil {
+		ev.Error = opErr.Error()
+	}
+	sinkErr := a.sink.Record(ev)
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	usage, ok := a.usage[keyName]
+	if !ok {
+		usage = newKeyUsage()
+		a.usage[keyName] = usage
+	}
+	switch outcome {
+	case AuditSuccess:
+		usage.Counts[op]++
+		usage.LastUsed = ev.Timestamp
+	case AuditFailure:
+		usage.Failures[op]++
+	}
+	if sinkErr != nil {
+		if outcome != AuditAttempt {
+			usage.Unrecorded++
+		}
+		return fmt.Errorf("failed to record audit event: %s", sinkErr.Error())
+	}
+	return nil
+}
+
+func (a *auditor) keyUsage(keyName string) KeyUsage {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+	out := newKeyUsage()
+	if usage, ok := a.usage[keyName]; ok {
+		for op, count := range usage.Counts {
+			out.Counts[op] = count
+		}
+		for op, count := range usage.Failures {
+			out.Failures[op] = count
+		}
+		out.LastUsed = usage.LastUsed
+		out.Unrecorded = usage.Unrecorded
+	}
+	return *out
+}
+
+// DatastoreAuditSink stores audit events in a datastore, and supports queries
+type DatastoreAuditSink struct {
+	ds  datastore.Batching
+	seq uint64
+}
+
+// NewDatastoreAuditSink is used to create an audit sink backed by the given datastore
+func NewDatastoreAuditSink(ds datastore.Batching) *DatastoreAuditSink {
+	return &DatastoreAuditSink{ds: namespace.Wrap(ds, datastore.NewKey("/rtfsaudit"))}
+}
+
+// Record is used to store an audit event
+func (s *DatastoreAuditSink) Record(ev AuditEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	// keys sort by the time the event was recorded
+	key := datastore.NewKey(fmt.Sprintf("%020d-%020d", ev.Timestamp.UnixNano(), atomic.AddUint64(&s.seq, 1)))
+	return s.ds.Put(key, data)
+}
+
+// Query is used to retrieve all stored events matching the query, oldest first
+func (s *DatastoreAuditSink) Query(q AuditQuery) ([]AuditEvent, error) {
+	results, err := s.ds.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, err
+	}
+	var events []AuditEvent
+	for _, entry := range entries {
+		var ev AuditEvent
+		if err := json.Unmarshal(entry.Value, &ev); err != nil {
+			return nil, err
+		}
+		if q.Matches(ev) {
+			events = append(events, ev)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	return events, nil
+}
+
+// WriterAuditSink writes audit events to an io.Writer as JSON lines.
+// The written log can be queried with ReadAuditLog
+type WriterAuditSink struct {
+	mux sync.Mutex
+	enc *json.Encoder
+}
+
+// NewWriterAuditSink is used to create an audit sink that writes to w
+func NewWriterAuditSink(w io.Writer) *WriterAuditSink {
+	return &WriterAuditSink{enc: json.NewEncoder(w)}
+}
+
+// Record is used to write an audit event
+func (s *WriterAuditSink) Record(ev AuditEvent) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.enc.Encode(ev)
+}
+
+// ReadAuditLog is used to read all events matching the query from
+// a JSON lines audit log, such as one written by WriterAuditSink
+func ReadAuditLog(r io.Reader, q AuditQuery) ([]AuditEvent, error) {
+	var events []AuditEvent
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var ev AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, err
+		}
+		if q.Matches(ev) {
+			events = append(events, ev)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// WithAudit returns a copy of the keystore manager which records every attempted
+// access, creation, export and deletion of a key to the given sink, along with its outcome
+func (km *KeystoreManager) WithAudit(sink AuditSink) *KeystoreManager {
+	return &KeystoreManager{
+		store:     km.store,
+		audit:     newAuditor(sink),
+		principal: km.principal,
+	}
+}
+
+// As returns a copy of the keystore manager which attributes all
+// audited operations to the given principal
+func (km *KeystoreManager) As(principal string) *KeystoreManager {
+	return &KeystoreManager{
+		store:     km.store,
+		audit:     km.audit,
+		principal: principal,
+	}
+}
+
+// KeyUsage returns the usage counters of the named key since auditing was enabled
+func (km *KeystoreManager) KeyUsage(keyName string) (KeyUsage, error) {
+	if km.audit == nil {
+		return KeyUsage{}, errors.New("auditing is not enabled")
+	}
+	return km.audit.keyUsage(keyName), nil
+}
+
+// QueryAudit is used to search the audit log, if the configured sink supports it
+func (km *KeystoreManager) QueryAudit(q AuditQuery) ([]AuditEvent, error) {
+	if km.audit == nil {
+		return nil, errors.New("auditing is not enabled")
+	}
+	querier, ok := km.audit.sink.(AuditQuerier)
+	if !ok {
+		return nil, errors.New("audit sink does not support queries")
+	}
+	return querier.Query(q)
+}
+
+// audited is used to perform an operation against the named key. The attempt is recorded
+// first, and the operation refused if that fails. The outcome is recorded afterwards, but
+// failing to record it does not fail an operation which has already taken place, and is
+// instead counted in KeyUsage. This is a no-op wrapper when auditing is disabled
+func (km *KeystoreManager) audited(keyName string, op AuditOperation, fn func() error) error {
+	if km.audit == nil {
+		return fn()
+	}
+	if err := km.audit.record(keyName, op, AuditAttempt, nil, km.principal); err != nil {
+		return err
+	}
+	err := fn()
+	outcome := AuditSuccess
+	if err != nil {
+		outcome = AuditFailure
+	}
+	km.audit.record(keyName, op, outcome, err, km.principal)
+	return err
+}
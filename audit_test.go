@@ -0,0 +1,152 @@
+package rtfs_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/RTradeLtd/rtfs/v2"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+func TestAudit_Datastore(t *testing.T) {
+	sink := rtfs.NewDatastoreAuditSink(dssync.MutexWrap(datastore.NewMapDatastore()))
+	km := newTestKeystoreManager(t).WithAudit(sink)
+	alice, bob := km.As("alice"), km.As("bob")
+	if _, err := alice.CreateAndSaveKey("key1", ci.Ed25519, 256); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.GetPrivateKeyByName("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.Sign("key1", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.ExportKeyAsMnemonic("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.DeleteKey("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.GetPrivateKeyByName("missing"); err == nil {
+		t.Fatal("expected error accessing missing key")
+	}
+	// every operation records an attempt followed by its outcome
+	tests := []struct {
+		name  string
+		query rtfs.AuditQuery
+		count int
+	}{
+		{"All", rtfs.AuditQuery{}, 12},
+		{"Key", rtfs.AuditQuery{KeyName: "key1"}, 10},
+		{"Unknown-Key", rtfs.AuditQuery{KeyName: "key2"}, 0},
+		{"Principal", rtfs.AuditQuery{Principal: "bob"}, 6},
+		{"Operation", rtfs.AuditQuery{Operation: rtfs.AuditAccess}, 6},
+		{"Export", rtfs.AuditQuery{Operation: rtfs.AuditExport, Outcome: rtfs.AuditSuccess}, 1},
+		{"Failure", rtfs.AuditQuery{Outcome: rtfs.AuditFailure, KeyName: "missing"}, 1},
+		{"Principal-And-Operation", rtfs.AuditQuery{Principal: "alice", Operation: rtfs.AuditDelete}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := km.QueryAudit(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != tt.count {
+				t.Fatalf("QueryAudit() returned %v events, want %v", len(events), tt.count)
+			}
+		})
+	}
+	events, err := km.QueryAudit(rtfs.AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events[0].Operation != rtfs.AuditCreate || events[0].Outcome != rtfs.AuditAttempt ||
+		events[len(events)-1].Outcome != rtfs.AuditFailure || events[len(events)-1].Error == "" {
+		t.Fatal("events not returned in order")
+	}
+	usage, err := km.KeyUsage("key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Counts[rtfs.AuditAccess] != 2 || usage.Counts[rtfs.AuditCreate] != 1 ||
+		usage.Counts[rtfs.AuditExport] != 1 || usage.Counts[rtfs.AuditDelete] != 1 {
+		t.Fatalf("bad usage counters %+v", usage.Counts)
+	}
+	if usage, _ = km.KeyUsage("missing"); usage.Failures[rtfs.AuditAccess] != 1 || len(usage.Counts) != 0 {
+		t.Fatalf("bad failure counters %+v", usage)
+	}
+}
+
+// failingSink fails to record events once broken, optionally only outcomes
+type failingSink struct {
+	broken       bool
+	outcomesOnly bool
+}
+
+func (s *failingSink) Record(ev rtfs.AuditEvent) error {
+	if s.broken && (!s.outcomesOnly || ev.Outcome != rtfs.AuditAttempt) {
+		return errors.New("sink unavailable")
+	}
+	return nil
+}
+
+func TestAudit_SinkFailure(t *testing.T) {
+	sink := new(failingSink)
+	km := newTestKeystoreManager(t).WithAudit(sink)
+	if _, err := km.CreateAndSaveKey("key1", ci.Ed25519, 256); err != nil {
+		t.Fatal(err)
+	}
+	// operations are refused when their attempt can not be recorded
+	sink.broken = true
+	if _, err := km.GetPrivateKeyByName("key1"); err == nil {
+		t.Fatal("expected error when the attempt can not be recorded")
+	}
+	if err := km.DeleteKey("key1"); err == nil {
+		t.Fatal("expected error when the attempt can not be recorded")
+	}
+	if present, err := km.CheckIfKeyExists("key1"); err != nil || !present {
+		t.Fatal("key was deleted without being audited")
+	}
+	// completed operations succeed when only their outcome can not be recorded
+	sink.outcomesOnly = true
+	if err := km.DeleteKey("key1"); err != nil {
+		t.Fatalf("DeleteKey() err = %v, want nil", err)
+	}
+	usage, err := km.KeyUsage("key1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Unrecorded != 1 || usage.Counts[rtfs.AuditDelete] != 1 {
+		t.Fatalf("bad usage counters %+v", usage)
+	}
+}
+
+func TestAudit_Writer(t *testing.T) {
+	buf := new(bytes.Buffer)
+	km := newTestKeystoreManager(t).WithAudit(rtfs.NewWriterAuditSink(buf)).As("alice")
+	if _, err := km.CreateAndSaveKey("key1", ci.Ed25519, 256); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := km.GetPrivateKeyByName("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := km.QueryAudit(rtfs.AuditQuery{}); err == nil {
+		t.Fatal("expected error querying writer sink")
+	}
+	events, err := rtfs.ReadAuditLog(buf, rtfs.AuditQuery{Principal: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatal("bad event count")
+	}
+	if events[3].KeyName != "key1" || events[3].Operation != rtfs.AuditAccess || events[3].Outcome != rtfs.AuditSuccess {
+		t.Fatal("bad event recovered")
+	}
+	if _, err := newTestKeystoreManager(t).KeyUsage("key1"); err == nil {
+		t.Fatal("expected error when auditing is disabled")
+	}
+}
@@ -0,0 +1,232 @@
+package rtfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// a minimal cbor implementation, covering the subset of dag-cbor used
+// by ipns records. Maps are always encoded with their keys sorted
+// length first, then bytewise, as required by dag-cbor.
+
+// cbor major types
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborSimple = 7
+)
+
+// cborEncode encodes v, which may be a map[string]interface{}, []interface{},
+// []byte, string, bool, nil, or any signed or unsigned integer
+func cborEncode(v interface{}) ([]byte, error) {
+	return cborAppend(nil, v)
+}
+
+func cborAppend(buf []byte, v interface{}) ([]byte, error) {
+	var err error
+	switch v := v.(type) {
+	case nil:
+		return append(buf, cborSimple<<5|22), nil
+	case bool:
+		if v {
+			return append(buf, cborSimple<<5|21), nil
+		}
+		return append(buf, cborSimple<<5|20), nil
+	case uint64:
+		return cborAppendHead(buf, cborUint, v), nil
+	case uint32:
+		return cborAppendHead(buf, cborUint, uint64(v)), nil
+	case uint:
+		return cborAppendHead(buf, cborUint, uint64(v)), nil
+	case int64:
+		return cborAppendInt(buf, v), nil
+	case int32:
+		return cborAppendInt(buf, int64(v)), nil
+	case int:
+		return cborAppendInt(buf, int64(v)), nil
+	case []byte:
+		buf = cborAppendHead(buf, cborBytes, uint64(len(v)))
+		return append(buf, v...), nil
+	case string:
+		buf = cborAppendHead(buf, cborText, uint64(len(v)))
+		return append(buf, v...), nil
+	case []interface{}:
+		buf = cborAppendHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if buf, err = cborAppend(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+		buf = cborAppendHead(buf, cborMap, uint64(len(v)))
+		for _, key := range keys {
+			buf = cborAppendHead(buf, cborText, uint64(len(key)))
+			buf = append(buf, key...)
+			if buf, err = cborAppend(buf, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("cbor: unsupported type %T", v)
+	}
+}
+
+func cborAppendInt(buf []byte, v int64) []byte {
+	if v < 0 {
+		return cborAppendHead(buf, cborNegInt, uint64(-1-v))
+	}
+	return cborAppendHead(buf, cborUint, uint64(v))
+}
+
+// cborAppendHead appends the major type and argument using the shortest encoding
+func cborAppendHead(buf []byte, major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return append(buf, major<<5|byte(arg))
+	case arg <= 0xff:
+		return append(buf, major<<5|24, byte(arg))
+	case arg <= 0xffff:
+		buf = append(buf, major<<5|25)
+		return append(buf, byte(arg>>8), byte(arg))
+	case arg <= 0xffffffff:
+		buf = append(buf, major<<5|26)
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(arg))
+		return append(buf, b...)
+	default:
+		buf = append(buf, major<<5|27)
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, arg)
+		return append(buf, b...)
+	}
+}
+
+// cborDecode decodes data produced by cborEncode. Unsigned integers decode
+// as uint64, negative integers as int64, and maps as map[string]interface{}
+func cborDecode(data []byte) (interface{}, error) {
+	v, rest, err := cborNext(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("cbor: trailing data")
+	}
+	return v, nil
+}
+
+// cborMaxDepth bounds the nesting of decoded arrays and maps
+const cborMaxDepth = 32
+
+func cborNext(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, errors.New("cbor: maximum nesting depth exceeded")
+	}
+	if len(data) == 0 {
+		return nil, nil, errors.New("cbor: unexpected end of data")
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+	if major == cborSimple {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22:
+			return nil, data, nil
+		default:
+			return nil, nil, fmt.Errorf("cbor: unsupported simple value %v", info)
+		}
+	}
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(data) < size {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		for _, b := range data[:size] {
+			arg = arg<<8 | uint64(b)
+		}
+		data = data[size:]
+	default:
+		return nil, nil, errors.New("cbor: indefinite lengths are not supported")
+	}
+	switch major {
+	case cborUint:
+		return arg, data, nil
+	case cborNegInt:
+		return -1 - int64(arg), data, nil
+	case cborBytes, cborText:
+		if uint64(len(data)) < arg {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		if major == cborText {
+			return string(data[:arg]), data[arg:], nil
+		}
+		out := make([]byte, arg)
+		copy(out, data[:arg])
+		return out, data[arg:], nil
+	case cborArray:
+		if uint64(len(data)) < arg {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		out := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var (
+				item interface{}
+				err  error
+			)
+			if item, data, err = cborNext(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			out = append(out, item)
+		}
+		return out, data, nil
+	case cborMap:
+		if uint64(len(data)) < arg {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		out := make(map[string]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			var (
+				key, value interface{}
+				err        error
+			)
+			if key, data, err = cborNext(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, nil, errors.New("cbor: map keys must be strings")
+			}
+			if value, data, err = cborNext(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			out[name] = value
+		}
+		return out, data, nil
+	default:
+		return nil, nil, fmt.Errorf("cbor: unsupported major type %v", major)
+	}
+}
@@ -0,0 +1,115 @@
+package rtfs
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	mbase "github.com/multiformats/go-multibase"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// ParseCID is used to parse and validate a cid, given either bare or as an /ipfs/<cid> path
+func ParseCID(hash string) (cid.Cid, error) {
+	trimmed := strings.TrimSuffix(strings.TrimPrefix(hash, "/ipfs/"), "/")
+	if trimmed == "" {
+		return cid.Undef, errors.New("cid is empty")
+	}
+	if strings.Contains(trimmed, "/") {
+		return cid.Undef, fmt.Errorf("'%s' is a path, not a cid", hash)
+	}
+	c, err := cid.Decode(trimmed)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("invalid cid '%s': %s", hash, err.Error())
+	}
+	return c, nil
+}
+
+// CIDToV1 is used to convert a cid to version 1, encoded in base32. Base32 cids are
+// case insensitive, so can be used as subdomains, such as <cid>.ipfs.dweb.link
+func CIDToV1(hash string) (string, error) {
+	c, err := ParseCID(hash)
+	if err != nil {
+		return "", err
+	}
+	return cid.NewCidV1(c.Type(), c.Hash()).StringOfBase(mbase.Base32)
+}
+
+// CIDToV0 is used to convert a cid to version 0. Only dag-pb cids using a
+// sha2-256 multihash can be represented as version 0
+func CIDToV0(hash string) (string, error) {
+	c, err := ParseCID(hash)
+	if err != nil {
+		return "", err
+	}
+	if c.Type() != cid.DagProtobuf {
+		return "", fmt.Errorf("'%s' is not a dag-pb cid, so has no version 0 form", hash)
+	}
+	decoded, err := mh.Decode(c.Hash())
+	if err != nil {
+		return "", err
+	}
+	if decoded.Code != mh.SHA2_256 || decoded.Length != 32 {
+		return "", fmt.Errorf("'%s' does not use a sha2-256 hash, so has no version 0 form", hash)
+	}
+	return cid.NewCidV0(c.Hash()).String(), nil
+}
+
+// FormatCID is used to encode a cid with the named multibase, such as "base32" or
+// "base58btc". Version 0 cids can only be encoded in base58btc, so are converted
+// to version 1 when any other base is requested
+func FormatCID(hash, base string) (string, error) {
+	c, err := ParseCID(hash)
+	if err != nil {
+		return "", err
+	}
+	encoder, err := mbase.EncoderByName(base)
+	if err != nil {
+		return "", err
+	}
+	if c.Version() == 0 {
+		if encoder.Encoding() == mbase.Base58BTC {
+			return c.String(), nil
+		}
+		c = cid.NewCidV1(c.Type(), c.Hash())
+	}
+	return c.Encode(encoder), nil
+}
+
+// NormalizeIPFSPath is used to convert a cid or path into the canonical /ipfs/<cid>/a/b
+// form. Bare cids, <cid>/a/b, ipfs/<cid> and ipfs://<cid> are accepted, and repeated
+// slashes and dot segments are removed. The cid keeps its version
+func NormalizeIPFSPath(p string) (string, error) {
+	trimmed := p
+	for _, prefix := range []string{"ipfs://", "/ipfs/", "ipfs/"} {
+		if strings.HasPrefix(trimmed, prefix) {
+			trimmed = strings.TrimPrefix(trimmed, prefix)
+			break
+		}
+	}
+	if strings.HasPrefix(trimmed, "/ipns/") || strings.HasPrefix(trimmed, "ipns://") {
+		return "", fmt.Errorf("'%s' is an ipns path", p)
+	}
+	root, rest := splitPath(strings.TrimLeft(trimmed, "/"))
+	c, err := ParseCID(root)
+	if err != nil {
+		return "", err
+	}
+	if rest = path.Clean(rest); rest == "/" || rest == "." {
+		rest = ""
+	}
+	return "/ipfs/" + c.String() + rest, nil
+}
+
+// cidArg is used to validate a cid, or a path beneath one, in any form accepted by
+// NormalizeIPFSPath, so that malformed input is rejected before a request is sent to
+// the node. It is returned as <cid>/a/b, so the node receives every form alike
+func cidArg(hash string) (string, error) {
+	normalized, err := NormalizeIPFSPath(hash)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(normalized, "/ipfs/"), nil
+}
@@ -0,0 +1,243 @@
+package rtfs_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/RTradeLtd/rtfs/v2"
+)
+
+const (
+	testEmptyDirV0 = "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"
+	testEmptyDirV1 = "bafybeiczsscdsbs7ffqz55asqdf3smv6klcw3gofszvwlyarci47bgf354"
+	testRawCID     = "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"
+)
+
+func TestParseCID(t *testing.T) {
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr bool
+	}{
+		{"V0", testEmptyDirV0, false},
+		{"V1", testEmptyDirV1, false},
+		{"IPFS-Path", "/ipfs/" + testEmptyDirV1 + "/", false},
+		{"Sub-Path", "/ipfs/" + testEmptyDirV1 + "/a", true},
+		{"Truncated", testEmptyDirV0[:20], true},
+		{"Garbage", "not a cid", true},
+		{"Empty", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := rtfs.ParseCID(tt.hash); (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCID() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCIDConversion(t *testing.T) {
+	tests := []struct {
+		name    string
+		convert func(string) (string, error)
+		hash    string
+		want    string
+		wantErr bool
+	}{
+		{"V0-To-V1", rtfs.CIDToV1, testEmptyDirV0, testEmptyDirV1, false},
+		{"V1-To-V1", rtfs.CIDToV1, testEmptyDirV1, testEmptyDirV1, false},
+		{"V1-To-V0", rtfs.CIDToV0, testEmptyDirV1, testEmptyDirV0, false},
+		{"Path-To-V0", rtfs.CIDToV0, "/ipfs/" + testEmptyDirV1, testEmptyDirV0, false},
+		{"Raw-To-V0", rtfs.CIDToV0, testRawCID, "", true},
+		{"Invalid", rtfs.CIDToV1, "bafy", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.convert(tt.hash)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("convert() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("convert() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatCID(t *testing.T) {
+	tests := []struct {
+		name    string
+		hash    string
+		base    string
+		want    string
+		wantErr bool
+	}{
+		{"V0-Base58", testEmptyDirV0, "base58btc", testEmptyDirV0, false},
+		{"V0-Base32", testEmptyDirV0, "base32", testEmptyDirV1, false},
+		{"V1-Base32", testEmptyDirV1, "base32", testEmptyDirV1, false},
+		{"V1-Base58", testEmptyDirV1, "base58btc", "z", false},
+		{"Unknown-Base", testEmptyDirV1, "base1000", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rtfs.FormatCID(tt.hash, tt.base)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FormatCID() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !strings.HasPrefix(got, tt.want) {
+				t.Fatalf("FormatCID() = %v, want %v", got, tt.want)
+			}
+			// every encoding must decode to the same cid
+			v1, err := rtfs.CIDToV1(got)
+			if err != nil || v1 != testEmptyDirV1 {
+				t.Fatalf("CIDToV1(%v) = %v, err = %v", got, v1, err)
+			}
+		})
+	}
+}
+
+func TestNormalizeIPFSPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"Bare", testEmptyDirV0, "/ipfs/" + testEmptyDirV0, false},
+		{"IPFS-Path", "/ipfs/" + testEmptyDirV1 + "/", "/ipfs/" + testEmptyDirV1, false},
+		{"Relative", "ipfs/" + testEmptyDirV1 + "/a", "/ipfs/" + testEmptyDirV1 + "/a", false},
+		{"URL", "ipfs://" + testEmptyDirV1 + "/a/b", "/ipfs/" + testEmptyDirV1 + "/a/b", false},
+		{"Messy", "/ipfs//" + testEmptyDirV1 + "//a/./b/../c/", "/ipfs/" + testEmptyDirV1 + "/a/c", false},
+		{"Escape", testEmptyDirV1 + "/../../etc", "/ipfs/" + testEmptyDirV1 + "/etc", false},
+		{"IPNS", "/ipns/example.com", "", true},
+		{"Invalid-CID", "/ipfs/not-a-cid/a", "", true},
+		{"Empty", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rtfs.NormalizeIPFSPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeIPFSPath() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("NormalizeIPFSPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_InvalidCID(t *testing.T) {
+	var requests []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	im := newFakeNode(t, map[string]http.HandlerFunc{
+		"cat": handler, "object/stat": handler, "pin/add": handler, "pin/ls": handler,
+		"pin/update": handler, "refs": handler, "dag/get": handler, "name/publish": handler,
+		"object/patch/add-link": handler, "object/patch/rm-link": handler,
+		"object/patch/set-data": handler, "object/patch/append-data": handler,
+		"name/resolve": handler,
+	})
+	const bad = "not-a-cid"
+	calls := map[string]func() error{
+		"Cat":         func() error { _, err := im.Cat(bad); return err },
+		"Stat":        func() error { _, err := im.Stat(bad); return err },
+		"Pin":         func() error { return im.Pin(bad) },
+		"CheckPin":    func() error { _, err := im.CheckPin(bad); return err },
+		"PinUpdate":   func() error { _, err := im.PinUpdate(testEmptyDirV0, bad); return err },
+		"Refs":        func() error { _, err := im.Refs(bad, true, true); return err },
+		"DagGet":      func() error { return im.DagGet("", nil) },
+		"DagLinks":    func() error { _, err := im.DagLinks(bad); return err },
+		"Publish":     func() error { _, err := im.Publish(bad, "self", 0, 0, false); return err },
+		"PatchLink":   func() error { _, err := im.PatchLink(testEmptyDirV0, "a", bad, false); return err },
+		"PatchRmLink": func() error { _, err := im.PatchRmLink(bad, "a"); return err },
+		"SetData":     func() error { _, err := im.SetData(bad, "data"); return err },
+		"AppendData":  func() error { _, err := im.AppendData(bad, "data"); return err },
+		"Dedup":       func() error { _, err := im.DeduplicatedSize(bad); return err },
+		"Resolve":     func() error { _, err := im.Resolve("/ipfs/" + bad); return err },
+	}
+	for name, call := range calls {
+		if err := call(); err == nil {
+			t.Fatalf("%s() err = nil, want an error", name)
+		}
+	}
+	if len(requests) != 0 {
+		t.Fatalf("requests = %v, want none", requests)
+	}
+}
+
+func TestManager_CIDForms(t *testing.T) {
+	var args []string
+	im := newFakeNode(t, map[string]http.HandlerFunc{
+		"cat": func(w http.ResponseWriter, r *http.Request) {
+			args = append(args, r.URL.Query().Get("arg"))
+		},
+	})
+	forms := []string{
+		testEmptyDirV1 + "/a",
+		"/ipfs/" + testEmptyDirV1 + "/a",
+		"ipfs/" + testEmptyDirV1 + "//a/",
+		"ipfs://" + testEmptyDirV1 + "/a",
+	}
+	for _, form := range forms {
+		if _, err := im.Cat(form); err != nil {
+			t.Fatalf("Cat(%s) err = %v", form, err)
+		}
+		root, rest, err := rtfs.ParseDagPath(form)
+		if err != nil {
+			t.Fatalf("ParseDagPath(%s) err = %v", form, err)
+		}
+		if root.String() != testEmptyDirV1 || rest != "a" {
+			t.Fatalf("ParseDagPath(%s) = %s, %s", form, root, rest)
+		}
+	}
+	for i, arg := range args {
+		if arg != testEmptyDirV1+"/a" {
+			t.Fatalf("Cat(%s) sent %s, want %s", forms[i], arg, testEmptyDirV1+"/a")
+		}
+	}
+	if _, _, err := rtfs.ParseDagPath("/ipns/" + testEmptyDirV1); err == nil {
+		t.Fatal("ParseDagPath() err = nil, want an error for an ipns path")
+	}
+}
+
+func TestCheckPin_Version(t *testing.T) {
+	im := newFakeNode(t, map[string]http.HandlerFunc{
+		"pin/ls": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"Keys":{"` + testEmptyDirV0 + `":{"Type":"recursive"}}}`))
+		},
+		"resolve": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("arg") != testRawCID+"/a" {
+				t.Errorf("bad path resolved %s", r.URL.Query().Get("arg"))
+			}
+			w.Write([]byte(`{"Path":"/ipfs/` + testEmptyDirV1 + `"}`))
+		},
+	})
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{"V0", testEmptyDirV0, true},
+		{"V1", testEmptyDirV1, true},
+		{"URL", "ipfs://" + testEmptyDirV1, true},
+		{"Path", "ipfs/" + testRawCID + "/a", true},
+		{"Other", testRawCID, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := im.CheckPin(tt.hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("CheckPin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
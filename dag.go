@@ -0,0 +1,113 @@
+package rtfs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+)
+
+// ipld codecs. Links within dag-json and dag-cbor objects are represented as
+// {"/": "<cid>"}, which decodes into cid.Cid fields of the struct passed to DagGetPath
+const (
+	CodecDagCBOR = "dag-cbor"
+	CodecDagJSON = "dag-json"
+	CodecDagPB   = "dag-pb"
+	CodecRaw     = "raw"
+)
+
+// hash functions objects may be stored with
+const (
+	HashSHA256  = "sha2-256"
+	HashSHA512  = "sha2-512"
+	HashSHA3    = "sha3-256"
+	HashBlake2b = "blake2b-256"
+)
+
+// legacyCodecNames maps codecs to the names used by nodes which
+// predate the input-codec and store-codec options
+var legacyCodecNames = map[string]string{
+	CodecDagCBOR: "cbor",
+	CodecDagJSON: "json",
+	CodecDagPB:   "protobuf",
+	CodecRaw:     "raw",
+}
+
+// DagPutOpts is used to control how an object is stored
+type DagPutOpts struct {
+	// InputCodec is the codec the data is encoded with, defaults to CodecDagJSON
+	InputCodec string
+	// StoreCodec is the codec the object is stored as, defaults to CodecDagCBOR
+	StoreCodec string
+	// Hash is the hash function used for the object's cid, defaults to HashSHA256
+	Hash string
+	// Pin pins the object once stored
+	Pin bool
+}
+
+// defaults validates the options, filling in any that are unset
+func (o *DagPutOpts) defaults() error {
+	if o.InputCodec == "" {
+		o.InputCodec = CodecDagJSON
+	}
+	if o.StoreCodec == "" {
+		o.StoreCodec = CodecDagCBOR
+	}
+	if o.Hash == "" {
+		o.Hash = HashSHA256
+	}
+	for _, codec := range []string{o.InputCodec, o.StoreCodec} {
+		if _, ok := legacyCodecNames[codec]; !ok {
+			return fmt.Errorf("unsupported codec '%s'", codec)
+		}
+	}
+	return nil
+}
+
+// ParseDagPath is used to validate a path into an ipld object, given in any form
+// accepted by NormalizeIPFSPath, returning the root cid and the path within it
+func ParseDagPath(p string) (cid.Cid, string, error) {
+	normalized, err := NormalizeIPFSPath(p)
+	if err != nil {
+		return cid.Undef, "", err
+	}
+	root, rest := splitPath(strings.TrimPrefix(normalized, "/ipfs/"))
+	c, err := cid.Decode(root)
+	if err != nil {
+		return cid.Undef, "", err
+	}
+	return c, strings.TrimPrefix(rest, "/"), nil
+}
+
+// DagLink is a named link from one ipld object to another
+type DagLink struct {
+	Name string
+	Hash string
+	// Size is the cumulative size of the linked object, which
+	// is only known for links from dag-pb objects
+	Size uint64
+}
+
+// RefsOpts is used to control the refs listed by RefsStream
+type RefsOpts struct {
+	// Recursive lists the refs of every object under the root
+	Recursive bool
+	// Unique omits refs which have already been listed
+	Unique bool
+	// Edges lists refs as "<src> -> <dst>"
+	Edges bool
+	// MaxDepth limits recursion to the given depth, zero is unlimited.
+	// Setting it implies Recursive
+	MaxDepth int
+	// Format is a custom format for each ref, using the tokens <src>,
+	// <dst> and <linkname>. It can not be combined with Edges
+	Format string
+}
+
+// RefResult is a single ref streamed by RefsStream
+type RefResult struct {
+	Ref string
+	// Err is set when the node fails to list a ref, such as
+	// when an object can not be retrieved
+	Err error
+}
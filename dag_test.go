@@ -0,0 +1,197 @@
+package rtfs_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/rtfs/v2"
+	"github.com/ipfs/go-cid"
+)
+
+func TestDagPutWithOptions_Options(t *testing.T) {
+	var query map[string][]string
+	im := newFakeNode(t, map[string]http.HandlerFunc{
+		"dag/put": func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			w.Write([]byte(`{"Cid":{"/":"` + testPIN + `"}}`))
+		},
+	})
+	tests := []struct {
+		name    string
+		data    interface{}
+		opts    rtfs.DagPutOpts
+		want    map[string]string
+		wantErr bool
+	}{
+		{"Defaults", []byte(`{}`), rtfs.DagPutOpts{},
+			map[string]string{"input-codec": "dag-json", "store-codec": "dag-cbor", "input-enc": "json", "format": "cbor", "hash": "sha2-256", "pin": "false"}, false},
+		{"Raw", "hello", rtfs.DagPutOpts{InputCodec: rtfs.CodecRaw, StoreCodec: rtfs.CodecRaw, Hash: rtfs.HashBlake2b, Pin: true},
+			map[string]string{"input-codec": "raw", "store-codec": "raw", "input-enc": "raw", "format": "raw", "hash": "blake2b-256", "pin": "true"}, false},
+		{"Struct", struct{ Foo string }{"bar"}, rtfs.DagPutOpts{InputCodec: rtfs.CodecRaw, StoreCodec: rtfs.CodecDagPB},
+			map[string]string{"input-codec": "dag-json", "store-codec": "dag-pb", "format": "protobuf"}, false},
+		{"Bad-Codec", []byte(`{}`), rtfs.DagPutOpts{StoreCodec: "xml"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query = nil
+			got, err := im.DagPutWithOptions(tt.data, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DagPutWithOptions() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != testPIN {
+				t.Fatalf("DagPutWithOptions() = %v, want %v", got, testPIN)
+			}
+			for option, value := range tt.want {
+				if len(query[option]) == 0 || query[option][0] != value {
+					t.Fatalf("option %s = %v, want %v", option, query[option], value)
+				}
+			}
+		})
+	}
+}
+
+func TestDagGetPath_Links(t *testing.T) {
+	var ref string
+	im := newFakeNode(t, map[string]http.HandlerFunc{
+		"dag/get": func(w http.ResponseWriter, r *http.Request) {
+			ref = r.URL.Query().Get("arg")
+			w.Write([]byte(`{"name":"child","link":{"/":"` + testRefsHash + `"}}`))
+		},
+	})
+	type object struct {
+		Name string  `json:"name"`
+		Link cid.Cid `json:"link"`
+	}
+	tests := []struct {
+		name    string
+		path    string
+		wantRef string
+		wantErr bool
+	}{
+		{"CID", testPIN, testPIN, false},
+		{"Path", testPIN + "/a/b", testPIN + "/a/b", false},
+		{"IPFS-Path", "/ipfs/" + testPIN + "/a/", testPIN + "/a", false},
+		{"Invalid", "notacid/a", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out object
+			err := im.DagGetPath(tt.path, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DagGetPath() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if ref != tt.wantRef {
+				t.Fatalf("DagGetPath() requested %v, want %v", ref, tt.wantRef)
+			}
+			if out.Name != "child" || out.Link.String() != testRefsHash {
+				t.Fatal("failed to decode object")
+			}
+		})
+	}
+}
+
+func TestDagPutWithOptions(t *testing.T) {
+	im, err := rtfs.NewManager(nodeOneAPIAddr, "", time.Minute*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type testDag struct {
+		Foo string `json:"foo"`
+		Bar string `json:"bar"`
+	}
+	hash, err := im.DagPutWithOptions(testDag{"hello", "world"}, rtfs.DagPutOpts{Pin: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// matches the object stored by TestDagPut
+	if hash != "bafyreiaopeffny6qlthkjaoqri4qz5ru544mfpjfo3rvkgv4qq2zfjvgtm" {
+		t.Fatal("failed to generate correct dag object")
+	}
+	type parent struct {
+		Child cid.Cid `json:"child"`
+	}
+	child, err := cid.Decode(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := im.DagPutWithOptions(parent{child}, rtfs.DagPutOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out parent
+	if err := im.DagGetPath("/ipfs/"+root, &out); err != nil {
+		t.Fatal(err)
+	} else if !out.Child.Equals(child) {
+		t.Fatal("failed to decode link")
+	}
+	var foo string
+	if err := im.DagGetPath(root+"/child/foo", &foo); err != nil {
+		t.Fatal(err)
+	} else if foo != "hello" {
+		t.Fatal("failed to get path through link")
+	}
+}
+
+func TestDagLinks(t *testing.T) {
+	const cborHash = "bafyreiaopeffny6qlthkjaoqri4qz5ru544mfpjfo3rvkgv4qq2zfjvgtm"
+	var args []string
+	im := newFakeNode(t, map[string]http.HandlerFunc{
+		"object/links": func(w http.ResponseWriter, r *http.Request) {
+			args = append(args, r.URL.Query().Get("arg"))
+			w.Write([]byte(`{"Hash":"` + testPIN + `","Links":[{"Name":"readme","Hash":"` + testRefsHash + `","Size":42}]}`))
+		},
+		"refs": func(w http.ResponseWriter, r *http.Request) {
+			args = append(args, r.URL.Query().Get("arg"))
+			if r.URL.Query().Get("format") != "<dst> <linkname>" {
+				t.Error("bad refs format")
+			}
+			w.Write([]byte(`{"Ref":"` + testPIN + ` link with spaces","Err":""}` + "\n"))
+			w.Write([]byte(`{"Ref":"` + testRefsHash + ` other","Err":""}` + "\n"))
+		},
+	})
+	c, err := cid.Decode(cborHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cborLinks := []rtfs.DagLink{{Name: "link with spaces", Hash: testPIN}, {Name: "other", Hash: testRefsHash}}
+	tests := []struct {
+		name    string
+		hash    string
+		want    []rtfs.DagLink
+		wantArg string
+	}{
+		{"Dag-PB", testPIN, []rtfs.DagLink{{Name: "readme", Hash: testRefsHash, Size: 42}}, testPIN},
+		{"Dag-PB-URL", "ipfs://" + testPIN, []rtfs.DagLink{{Name: "readme", Hash: testRefsHash, Size: 42}}, testPIN},
+		{"Dag-CBOR", cborHash, cborLinks, cborHash},
+		// the type of an object given by path is unknown, so refs is used
+		{"Path", "/ipfs/" + testPIN + "//docs/", cborLinks, testPIN + "/docs"},
+		{"Raw", cid.NewCidV1(cid.Raw, c.Hash()).String(), nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args = nil
+			got, err := im.DagLinks(tt.hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantArg != "" && (len(args) != 1 || args[0] != tt.wantArg) {
+				t.Fatalf("DagLinks() sent %v, want %s", args, tt.wantArg)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("DagLinks() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("DagLinks() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package rtfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/spaolacci/murmur3"
+)
+
+// DefaultShardingThreshold is the estimated size of a directory's links above
+// which it is stored as a sharded HAMT directory, matching go-ipfs
+const DefaultShardingThreshold = 256 << 10
+
+// unixfs node types
+const (
+	unixfsDirectory = 1
+	unixfsHAMTShard = 5
+)
+
+// hamt parameters used by go-ipfs
+const (
+	hamtFanout      = 256
+	hamtHashMurmur3 = 0x22
+)
+
+// DirectoryBuilderOpts is used to configure a DirectoryBuilder
+type DirectoryBuilderOpts struct {
+	// ShardingThreshold is the estimated size of a directory's links above which
+	// it is sharded. Defaults to DefaultShardingThreshold, and a negative value
+	// disables sharding
+	ShardingThreshold int
+}
+
+// DirectoryBuilder is used to build a UnixFS directory tree locally, and store
+// it in a single pass once complete, instead of patching a root object one link
+// at a time. A builder is not safe for concurrent use
+type DirectoryBuilder struct {
+	im        Manager
+	threshold int
+	root      *dirNode
+}
+
+type dirNode struct {
+	entries map[string]*dirEntry
+}
+
+// dirEntry is either a directory being built, or existing content
+type dirEntry struct {
+	dir  *dirNode
+	hash cid.Cid
+	size uint64
+}
+
+// dirLink is a link of an encoded directory node
+type dirLink struct {
+	name string
+	hash cid.Cid
+	size uint64
+}
+
+// NewDirectoryBuilder is used to instantiate a DirectoryBuilder
+func NewDirectoryBuilder(im Manager, opts DirectoryBuilderOpts) *DirectoryBuilder {
+	if opts.ShardingThreshold == 0 {
+		opts.ShardingThreshold = DefaultShardingThreshold
+	}
+	return &DirectoryBuilder{
+		im:        im,
+		threshold: opts.ShardingThreshold,
+		root:      newDirNode(),
+	}
+}
+
+// Add is used to link existing content into the tree at p, such as "docs/readme.md",
+// creating any missing parent directories. size is the cumulative size of the
+// content, and if zero it is looked up with Stat when the tree is committed
+func (b *DirectoryBuilder) Add(p, hash string, size uint64) error {
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return err
+	}
+	parent, name, err := b.parent(p)
+	if err != nil {
+		return err
+	}
+	if existing, ok := parent.entries[name]; ok && existing.dir != nil {
+		return fmt.Errorf("'%s' is a directory", p)
+	}
+	parent.entries[name] = &dirEntry{hash: c, size: size}
+	return nil
+}
+
+// Mkdir is used to create a directory at p, along with any missing parents.
+// Directories are created implicitly by Add, so this is only needed for empty ones
+func (b *DirectoryBuilder) Mkdir(p string) error {
+	parent, name, err := b.parent(p)
+	if err != nil {
+		return err
+	}
+	if existing, ok := parent.entries[name]; ok {
+		if existing.dir == nil {
+			return fmt.Errorf("'%s' already exists and is not a directory", p)
+		}
+		return nil
+	}
+	parent.entries[name] = &dirEntry{dir: newDirNode()}
+	return nil
+}
+
+// Commit is used to store the tree, returning the cid of the root directory
+func (b *DirectoryBuilder) Commit() (string, error) {
+	hash, _, err := b.commit(b.root)
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
+// commit stores a directory and everything beneath it, returning its cid and cumulative size
+func (b *DirectoryBuilder) commit(dir *dirNode) (cid.Cid, uint64, error) {
+	links := make([]dirLink, 0, len(dir.entries))
+	var estimatedSize int
+	for name, entry := range dir.entries {
+		link := dirLink{name: name, hash: entry.hash, size: entry.size}
+		if entry.dir != nil {
+			var err error
+			if link.hash, link.size, err = b.commit(entry.dir); err != nil {
+				return cid.Undef, 0, err
+			}
+		} else if link.size == 0 {
+			stats, err := b.im.Stat(link.hash.String())
+			if err != nil {
+				return cid.Undef, 0, fmt.Errorf("failed to stat '%s': %s", name, err.Error())
+			}
+			link.size = uint64(stats.CumulativeSize)
+		}
+		estimatedSize += len(name) + len(link.hash.Bytes())
+		links = append(links, link)
+	}
+	sortDirLinks(links)
+	if b.threshold > 0 && estimatedSize >= b.threshold {
+		return b.commitShard(links, 0)
+	}
+	return b.put(encodeDirNode(links, encodeUnixfsData(unixfsDirectory, nil)), links)
+}
+
+// commitShard stores links as a HAMT shard at the given depth. Each level consumes one
+// byte of the murmur3 hash of the link name. Slots holding a single link point at it
+// directly, named by the slot index followed by the link name, while slots holding
+// several point at a child shard, named by the slot index alone
+func (b *DirectoryBuilder) commitShard(links []dirLink, depth int) (cid.Cid, uint64, error) {
+	if depth >= 8 {
+		return cid.Undef, 0, errors.New("hamt shard depth exceeded")
+	}
+	slots := make(map[int][]dirLink)
+	for _, link := range links {
+		slot := int(hamtHash(link.name)[depth])
+		slots[slot] = append(slots[slot], link)
+	}
+	bitfield := make([]byte, hamtFanout/8)
+	shardLinks := make([]dirLink, 0, len(slots))
+	for slot, slotLinks := range slots {
+		bitfield[len(bitfield)-1-slot/8] |= 1 << uint(slot%8)
+		prefix := fmt.Sprintf("%02X", slot)
+		if len(slotLinks) == 1 {
+			link := slotLinks[0]
+			link.name = prefix + link.name
+			shardLinks = append(shardLinks, link)
+			continue
+		}
+		hash, size, err := b.commitShard(slotLinks, depth+1)
+		if err != nil {
+			return cid.Undef, 0, err
+		}
+		shardLinks = append(shardLinks, dirLink{name: prefix, hash: hash, size: size})
+	}
+	sortDirLinks(shardLinks)
+	return b.put(encodeDirNode(shardLinks, encodeUnixfsData(unixfsHAMTShard, bitfield)), shardLinks)
+}
+
+// put stores an encoded directory node, checking the node agrees on its cid
+func (b *DirectoryBuilder) put(block []byte, links []dirLink) (cid.Cid, uint64, error) {
+	hash, err := mh.Sum(block, mh.SHA2_256, -1)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	want := cid.NewCidV0(hash)
+	got, err := b.im.BlockPut(block, "v0")
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	if got != want.String() {
+		return cid.Undef, 0, fmt.Errorf("node stored directory as '%s', expected '%s'", got, want.String())
+	}
+	size := uint64(len(block))
+	for _, link := range links {
+		size += link.size
+	}
+	return want, size, nil
+}
+
+// parent returns the directory that should hold p, creating it if needed, and the final path segment
+func (b *DirectoryBuilder) parent(p string) (*dirNode, string, error) {
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, "", fmt.Errorf("invalid path '%s'", p)
+		}
+	}
+	dir := b.root
+	for _, segment := range segments[:len(segments)-1] {
+		entry, ok := dir.entries[segment]
+		if !ok {
+			entry = &dirEntry{dir: newDirNode()}
+			dir.entries[segment] = entry
+		} else if entry.dir == nil {
+			return nil, "", fmt.Errorf("'%s' in '%s' is not a directory", segment, p)
+		}
+		dir = entry.dir
+	}
+	return dir, segments[len(segments)-1], nil
+}
+
+func newDirNode() *dirNode {
+	return &dirNode{entries: make(map[string]*dirEntry)}
+}
+
+func sortDirLinks(links []dirLink) {
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].name < links[j].name
+	})
+}
+
+// hamtHash returns the murmur3 hash used to place names within a HAMT
+func hamtHash(name string) []byte {
+	h := murmur3.New64()
+	h.Write([]byte(name))
+	return h.Sum(nil)
+}
+
+// encodeDirNode encodes a dag-pb node, which places links before data
+func encodeDirNode(links []dirLink, data []byte) []byte {
+	var buf []byte
+	for _, link := range links {
+		var pbLink []byte
+		pbLink = pbAppendBytes(pbLink, 1, link.hash.Bytes())
+		pbLink = pbAppendBytes(pbLink, 2, []byte(link.name))
+		pbLink = pbAppendVarint(pbLink, 3, link.size)
+		buf = pbAppendBytes(buf, 2, pbLink)
+	}
+	return pbAppendBytes(buf, 1, data)
+}
+
+// encodeUnixfsData encodes the unixfs data of a directory or HAMT shard
+func encodeUnixfsData(nodeType int, bitfield []byte) []byte {
+	data := pbAppendVarint(nil, 1, uint64(nodeType))
+	if nodeType == unixfsHAMTShard {
+		data = pbAppendBytes(data, 2, bitfield)
+		data = pbAppendVarint(data, 5, hamtHashMurmur3)
+		data = pbAppendVarint(data, 6, hamtFanout)
+	}
+	return data
+}
+
+func pbAppendVarint(buf []byte, field int, v uint64) []byte {
+	buf = pbAppendUvarint(buf, uint64(field)<<3)
+	return pbAppendUvarint(buf, v)
+}
+
+func pbAppendBytes(buf []byte, field int, v []byte) []byte {
+	buf = pbAppendUvarint(buf, uint64(field)<<3|2)
+	buf = pbAppendUvarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
+
+func pbAppendUvarint(buf []byte, v uint64) []byte {
+	b := make([]byte, binary.MaxVarintLen64)
+	return append(buf, b[:binary.PutUvarint(b, v)]...)
+}
@@ -0,0 +1,137 @@
+package rtfs_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/rtfs/v2"
+	"github.com/RTradeLtd/rtfs/v2/rtfstest"
+)
+
+// newFakeBlockNode returns a node which already holds testPIN
+func newFakeBlockNode() *rtfstest.Node {
+	node := rtfstest.NewNode()
+	node.SetObject(testPIN, []byte("hello world"))
+	return node
+}
+
+func TestDirectoryBuilder(t *testing.T) {
+	node := newFakeBlockNode()
+	empty, err := rtfs.NewDirectoryBuilder(node, rtfs.DirectoryBuilderOpts{}).Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty != "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn" {
+		t.Fatalf("Commit() = %v, want the empty unixfs directory", empty)
+	}
+
+	build := func(node *rtfstest.Node, threshold int, names []string) string {
+		builder := rtfs.NewDirectoryBuilder(node, rtfs.DirectoryBuilderOpts{ShardingThreshold: threshold})
+		for _, name := range names {
+			if err := builder.Add(name, testPIN, 10); err != nil {
+				t.Fatal(err)
+			}
+		}
+		root, err := builder.Commit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return root
+	}
+	// nested paths create a directory per level
+	node = newFakeBlockNode()
+	build(node, 0, []string{"docs/guides/readme.md", "docs/index.md", "/hello.txt"})
+	if len(node.Calls("BlockPut")) != 3 {
+		t.Fatalf("stored %v blocks, want 3", len(node.Calls("BlockPut")))
+	}
+	// the tree does not depend on the order entries are added in
+	if build(node, 0, []string{"b", "a", "c/d"}) != build(node, 0, []string{"c/d", "a", "b"}) {
+		t.Fatal("root depends on insertion order")
+	}
+
+	var names []string
+	for i := 0; i < 1000; i++ {
+		names = append(names, fmt.Sprintf("file-%d", i))
+	}
+	node = newFakeBlockNode()
+	flat := build(node, -1, names)
+	if len(node.Calls("BlockPut")) != 1 {
+		t.Fatalf("stored %v blocks without sharding, want 1", len(node.Calls("BlockPut")))
+	}
+	node = newFakeBlockNode()
+	sharded := build(node, 1024, names)
+	if sharded == flat {
+		t.Fatal("large directory was not sharded")
+	}
+	// 1000 names across 256 slots must collide, producing child shards
+	if len(node.Calls("BlockPut")) < 2 {
+		t.Fatalf("stored %v blocks when sharding, want several", len(node.Calls("BlockPut")))
+	}
+	var reversed []string
+	for i := len(names) - 1; i >= 0; i-- {
+		reversed = append(reversed, names[i])
+	}
+	if build(newFakeBlockNode(), 1024, reversed) != sharded {
+		t.Fatal("sharded root depends on insertion order")
+	}
+}
+
+func TestDirectoryBuilder_Errors(t *testing.T) {
+	node := newFakeBlockNode()
+	builder := rtfs.NewDirectoryBuilder(node, rtfs.DirectoryBuilderOpts{})
+	if err := builder.Add("docs/readme.md", testPIN, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.Mkdir("empty/nested"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"Invalid-CID", func() error { return builder.Add("file", "notacid", 0) }},
+		{"Replace-Directory", func() error { return builder.Add("docs", testPIN, 0) }},
+		{"File-As-Parent", func() error { return builder.Add("docs/readme.md/child", testPIN, 0) }},
+		{"Mkdir-Over-File", func() error { return builder.Mkdir("docs/readme.md") }},
+		{"Empty-Segment", func() error { return builder.Add("docs//file", testPIN, 0) }},
+		{"Dot-Dot", func() error { return builder.Add("docs/../file", testPIN, 0) }},
+		{"Empty", func() error { return builder.Mkdir("") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+	if _, err := builder.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// the size of content added without one is looked up
+	if stats := len(node.Calls("Stat")); stats != 1 {
+		t.Fatalf("Stat() called %v times, want 1", stats)
+	}
+}
+
+func TestDirectoryBuilder_Node(t *testing.T) {
+	im, err := rtfs.NewManager(nodeOneAPIAddr, "", time.Minute*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := rtfs.NewDirectoryBuilder(im, rtfs.DirectoryBuilderOpts{})
+	if err := builder.Add("nested/pin", testPIN, 0); err != nil {
+		t.Fatal(err)
+	}
+	root, err := builder.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := im.DagLinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].Name != "nested" {
+		t.Fatal("bad directory stored")
+	}
+}
@@ -0,0 +1,166 @@
+package rtfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// dnslinkPrefix is the prefix of TXT records holding a dnslink
+const dnslinkPrefix = "dnslink="
+
+// DefaultDNSLinkMaxDepth is the default number of dnslink records that will be followed
+const DefaultDNSLinkMaxDepth = 32
+
+// TXTResolver is used to lookup DNS TXT records. *net.Resolver satisfies this,
+// and can be pointed at a specific DNS server by setting its Dial function
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DNSLinkResolver is used to resolve DNSLink names
+type DNSLinkResolver struct {
+	resolver TXTResolver
+	maxDepth int
+}
+
+// NewDNSLinkResolver is used to instantiate a DNSLinkResolver. If resolver is nil
+// the system resolver is used, and if maxDepth is not positive DefaultDNSLinkMaxDepth is used
+func NewDNSLinkResolver(resolver TXTResolver, maxDepth int) *DNSLinkResolver {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if maxDepth <= 0 {
+		maxDepth = DefaultDNSLinkMaxDepth
+	}
+	return &DNSLinkResolver{resolver: resolver, maxDepth: maxDepth}
+}
+
+// ResolveOnce is used to lookup the dnslink of a domain without following it,
+// checking _dnslink.<domain> before falling back to the domain itself
+func (d *DNSLinkResolver) ResolveOnce(ctx context.Context, domain string) (string, error) {
+	domain = strings.TrimSuffix(domain, ".")
+	if !IsDomain(domain) {
+		return "", fmt.Errorf("'%s' is not a valid domain", domain)
+	}
+	var lookupErr error
+	for _, name := range []string{DNSLinkRecordName(domain), domain} {
+		records, err := d.resolver.LookupTXT(ctx, name)
+		if err != nil {
+			lookupErr = err
+			continue
+		}
+		link, err := parseDNSLink(records)
+		if err == nil {
+			return link, nil
+		}
+		lookupErr = err
+	}
+	return "", fmt.Errorf("failed to resolve dnslink for '%s': %s", domain, lookupErr.Error())
+}
+
+// Resolve is used to resolve a domain, or an /ipns/<domain> path, following dnslinks
+// which point at other domains until an /ipfs/ path or /ipns/<peer-id> is reached
+func (d *DNSLinkResolver) Resolve(ctx context.Context, name string) (string, error) {
+	domain, rest := splitIPNSPath(name)
+	for depth := 0; depth < d.maxDepth; depth++ {
+		link, err := d.ResolveOnce(ctx, domain)
+		if err != nil {
+			return "", err
+		}
+		next, remainder := splitIPNSPath(link)
+		if !strings.HasPrefix(link, "/ipns/") || !IsDomain(next) {
+			return link + rest, nil
+		}
+		domain, rest = next, remainder+rest
+	}
+	return "", fmt.Errorf("dnslink recursion limit of %v exceeded resolving '%s'", d.maxDepth, name)
+}
+
+// DNSLinkRecordName returns the name the dnslink TXT record for a domain should be set on
+func DNSLinkRecordName(domain string) string {
+	return "_dnslink." + strings.TrimSuffix(domain, ".")
+}
+
+// DNSLinkTXTRecord returns the content of the TXT record a user should set to link their
+// domain to target. The target may be a CID, an /ipfs/ path, or an /ipns/ path
+func DNSLinkTXTRecord(target string) (string, error) {
+	switch {
+	case strings.HasPrefix(target, "/ipfs/"):
+		root, _ := splitPath(strings.TrimPrefix(target, "/ipfs/"))
+		if _, err := cid.Decode(root); err != nil {
+			return "", fmt.Errorf("invalid cid in '%s': %s", target, err.Error())
+		}
+	case strings.HasPrefix(target, "/ipns/"):
+		name, _ := splitPath(strings.TrimPrefix(target, "/ipns/"))
+		if _, err := peer.Decode(name); err != nil && !IsDomain(name) {
+			return "", fmt.Errorf("'%s' is neither a peer id or domain", name)
+		}
+	default:
+		if _, err := cid.Decode(target); err != nil {
+			return "", fmt.Errorf("'%s' is not a cid, /ipfs/ path or /ipns/ path", target)
+		}
+		target = "/ipfs/" + target
+	}
+	return dnslinkPrefix + target, nil
+}
+
+// IsDomain returns whether or not name looks like a fully qualified domain name
+func IsDomain(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) == 0 || len(name) > 253 || !strings.Contains(name, ".") {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseDNSLink returns the dnslink held in a set of TXT records. When there are
+// several, the lexicographically smallest is used so resolution is deterministic
+func parseDNSLink(records []string) (string, error) {
+	var links []string
+	for _, record := range records {
+		if !strings.HasPrefix(record, dnslinkPrefix) {
+			continue
+		}
+		link := strings.TrimSpace(strings.TrimPrefix(record, dnslinkPrefix))
+		if strings.HasPrefix(link, "/ipfs/") || strings.HasPrefix(link, "/ipns/") {
+			links = append(links, link)
+		}
+	}
+	if len(links) == 0 {
+		return "", errors.New("no dnslink record found")
+	}
+	sort.Strings(links)
+	return links[0], nil
+}
+
+// splitIPNSPath splits a domain or /ipns/ path into its name, and the remaining path
+func splitIPNSPath(p string) (string, string) {
+	return splitPath(strings.TrimPrefix(p, "/ipns/"))
+}
+
+// splitPath splits a path into its first segment, and the remainder including the leading slash
+func splitPath(p string) (string, string) {
+	if idx := strings.Index(p, "/"); idx >= 0 {
+		return p[:idx], p[idx:]
+	}
+	return p, ""
+}
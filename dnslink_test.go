@@ -0,0 +1,92 @@
+package rtfs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/RTradeLtd/rtfs/v2"
+)
+
+// fakeTXTResolver is a stand-in dns server holding TXT records
+type fakeTXTResolver map[string][]string
+
+func (f fakeTXTResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, ok := f[name]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return records, nil
+}
+
+func TestDNSLinkResolver(t *testing.T) {
+	resolver := rtfs.NewDNSLinkResolver(fakeTXTResolver{
+		"_dnslink.example.com":  {"v=spf1 -all", "dnslink=/ipfs/" + testPIN},
+		"fallback.com":          {"dnslink=/ipfs/" + testRefsHash},
+		"_dnslink.alias.com":    {"dnslink=/ipns/example.com/docs"},
+		"_dnslink.peer.com":     {"dnslink=/ipns/" + testPIN},
+		"_dnslink.multiple.com": {"dnslink=/ipfs/b", "dnslink=/ipfs/a"},
+		"_dnslink.loop-a.com":   {"dnslink=/ipns/loop-b.com"},
+		"_dnslink.loop-b.com":   {"dnslink=/ipns/loop-a.com"},
+		"_dnslink.empty.com":    {"v=spf1 -all"},
+	}, 8)
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"Direct", "example.com", "/ipfs/" + testPIN, false},
+		{"IPNS-Path", "/ipns/example.com/readme", "/ipfs/" + testPIN + "/readme", false},
+		{"Fallback", "fallback.com", "/ipfs/" + testRefsHash, false},
+		{"Alias", "/ipns/alias.com/index.html", "/ipfs/" + testPIN + "/docs/index.html", false},
+		{"Peer-ID", "peer.com", "/ipns/" + testPIN, false},
+		{"Multiple", "multiple.com", "/ipfs/a", false},
+		{"Loop", "loop-a.com", "", true},
+		{"No-Record", "empty.com", "", true},
+		{"Missing", "missing.com", "", true},
+		{"Not-A-Domain", testPIN, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolver.Resolve(context.Background(), tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDNSLinkTXTRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		want    string
+		wantErr bool
+	}{
+		{"CID", testPIN, "dnslink=/ipfs/" + testPIN, false},
+		{"IPFS-Path", "/ipfs/" + testPIN + "/readme", "dnslink=/ipfs/" + testPIN + "/readme", false},
+		{"IPNS-Peer", "/ipns/" + testPIN, "dnslink=/ipns/" + testPIN, false},
+		{"IPNS-Domain", "/ipns/example.com", "dnslink=/ipns/example.com", false},
+		{"Invalid-CID", "notacid", "", true},
+		{"Invalid-IPFS-Path", "/ipfs/notacid", "", true},
+		{"Invalid-IPNS-Path", "/ipns/notaname", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rtfs.DNSLinkTXTRecord(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DNSLinkTXTRecord() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("DNSLinkTXTRecord() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if rtfs.DNSLinkRecordName("example.com.") != "_dnslink.example.com" {
+		t.Fatal("bad record name")
+	}
+}
@@ -0,0 +1,564 @@
+package rtfs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	ipfsapi "github.com/RTradeLtd/go-ipfs-api/v3"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// supported ciphers
+const (
+	// CipherAES256GCM encrypts content with AES-256 in GCM mode
+	CipherAES256GCM = iota + 1
+	// CipherXChaCha20Poly1305 encrypts content with XChaCha20-Poly1305
+	CipherXChaCha20Poly1305
+)
+
+// encryption chunk sizes
+const (
+	// DefaultEncryptionChunkSize is the amount of plaintext sealed in each chunk by default
+	DefaultEncryptionChunkSize = 64 << 10
+	// MaxEncryptionChunkSize is the largest chunk size that can be used, bounding
+	// the memory needed to decrypt content
+	MaxEncryptionChunkSize = 16 << 20
+)
+
+// encryptionMagic begins every encrypted object, and is followed by the format version
+const (
+	encryptionMagic   = "rtfsenc"
+	encryptionVersion = 1
+)
+
+// key derivation functions recorded in the header
+const (
+	// kdfNone uses the key as is, and is used for randomly generated keys
+	kdfNone = iota
+	// kdfScrypt derives the key from a passphrase
+	kdfScrypt
+	// kdfHKDF derives the key from a keystore private key
+	kdfHKDF
+	// kdfScryptHKDF derives a master key from a passphrase with scrypt, and the key
+	// of each object from the master key with hkdf, so that objects added together
+	// share one scrypt derivation while each having their own key. The salt holds
+	// the scrypt salt followed by the object salt
+	kdfScryptHKDF
+)
+
+// encryption parameters
+const (
+	encryptionKeySize  = 32
+	encryptionSaltSize = 16
+	// the nonce of each chunk is a random prefix, followed by a
+	// four byte chunk counter and a byte flagging the final chunk
+	nonceSuffixSize = 5
+	scryptN         = 1 << 15
+	scryptR         = 8
+	scryptP         = 1
+	hkdfInfo        = "rtfs-encryption-key"
+)
+
+// EncryptionKey is the secret used to encrypt and decrypt content. The key used
+// for each object is derived from it with a random salt stored in the header
+type EncryptionKey struct {
+	kdf    byte
+	secret []byte
+}
+
+// PassphraseKey is used to encrypt and decrypt content with a passphrase, which is
+// stretched with scrypt
+func PassphraseKey(passphrase string) EncryptionKey {
+	return EncryptionKey{kdf: kdfScrypt, secret: []byte(passphrase)}
+}
+
+// EncryptionKey is used to encrypt and decrypt content with the named key. The
+// encryption key is derived from the private key, which never leaves the keystore
+func (km *KeystoreManager) EncryptionKey(keyName string) (EncryptionKey, error) {
+	pk, err := km.GetPrivateKeyByName(keyName)
+	if err != nil {
+		return EncryptionKey{}, err
+	}
+	secret, err := pk.Raw()
+	if err != nil {
+		return EncryptionKey{}, err
+	}
+	return EncryptionKey{kdf: kdfHKDF, secret: secret}, nil
+}
+
+// derive returns the key used for an object encrypted with the given key derivation
+// function and salt. Passphrase keys can be used with either scrypt based function
+func (k EncryptionKey) derive(kdf byte, salt []byte) ([]byte, error) {
+	if len(k.secret) == 0 {
+		return nil, errors.New("encryption key is empty")
+	}
+	if kdf != k.kdf && !(k.kdf == kdfScrypt && kdf == kdfScryptHKDF) {
+		return nil, errors.New("content was encrypted with a different kind of key")
+	}
+	switch kdf {
+	case kdfNone:
+		if len(k.secret) != encryptionKeySize {
+			return nil, fmt.Errorf("encryption key must be %v bytes", encryptionKeySize)
+		}
+		return k.secret, nil
+	case kdfScrypt:
+		return scrypt.Key(k.secret, salt, scryptN, scryptR, scryptP, encryptionKeySize)
+	case kdfScryptHKDF:
+		master, err := scrypt.Key(k.secret, salt[:encryptionSaltSize], scryptN, scryptR, scryptP, encryptionKeySize)
+		if err != nil {
+			return nil, err
+		}
+		return hkdfKey(master, salt[encryptionSaltSize:])
+	case kdfHKDF:
+		return hkdfKey(k.secret, salt)
+	default:
+		return nil, errors.New("unknown key derivation function")
+	}
+}
+
+// hkdfKey is used to derive an encryption key from secret with hkdf
+func hkdfKey(secret, salt []byte) ([]byte, error) {
+	key := make([]byte, encryptionKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(hkdfInfo)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// kdfSaltSize returns the size of the salt stored in the header for a key derivation function
+func kdfSaltSize(kdf byte) int {
+	if kdf == kdfScryptHKDF {
+		return 2 * encryptionSaltSize
+	}
+	return encryptionSaltSize
+}
+
+// EncryptOpts is used to control how content is encrypted
+type EncryptOpts struct {
+	// Cipher is CipherAES256GCM or CipherXChaCha20Poly1305, defaulting to CipherAES256GCM
+	Cipher int
+	// ChunkSize is the amount of plaintext sealed in each chunk, defaulting
+	// to DefaultEncryptionChunkSize
+	ChunkSize int
+}
+
+// encryptionHeader describes how an object was encrypted. It is authenticated
+// along with every chunk, so that it can not be altered
+type encryptionHeader struct {
+	cipher      byte
+	kdf         byte
+	chunkSize   uint32
+	salt        []byte
+	noncePrefix []byte
+}
+
+func (h *encryptionHeader) marshal() []byte {
+	buf := append([]byte(encryptionMagic), encryptionVersion, h.cipher, h.kdf)
+	buf = append(buf, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(buf[len(buf)-4:], h.chunkSize)
+	buf = append(buf, h.salt...)
+	return append(buf, h.noncePrefix...)
+}
+
+// readEncryptionHeader reads and validates the header at the start of r
+func readEncryptionHeader(r io.Reader) (*encryptionHeader, error) {
+	fixed := make([]byte, len(encryptionMagic)+7)
+	if _, err := io.ReadFull(r, fixed); err != nil || !bytes.HasPrefix(fixed, []byte(encryptionMagic)) {
+		return nil, errors.New("content is not encrypted")
+	}
+	fields := fixed[len(encryptionMagic):]
+	if fields[0] != encryptionVersion {
+		return nil, fmt.Errorf("unsupported encryption version %v", fields[0])
+	}
+	h := &encryptionHeader{
+		cipher:    fields[1],
+		kdf:       fields[2],
+		chunkSize: binary.BigEndian.Uint32(fields[3:7]),
+		salt:      make([]byte, kdfSaltSize(fields[2])),
+	}
+	if _, err := io.ReadFull(r, h.salt); err != nil {
+		return nil, errors.New("encryption header is truncated")
+	}
+	if h.chunkSize == 0 || h.chunkSize > MaxEncryptionChunkSize {
+		return nil, fmt.Errorf("invalid chunk size %v", h.chunkSize)
+	}
+	nonceSize, err := cipherNonceSize(int(h.cipher))
+	if err != nil {
+		return nil, err
+	}
+	h.noncePrefix = make([]byte, nonceSize-nonceSuffixSize)
+	if _, err := io.ReadFull(r, h.noncePrefix); err != nil {
+		return nil, errors.New("encryption header is truncated")
+	}
+	return h, nil
+}
+
+func cipherNonceSize(c int) (int, error) {
+	switch c {
+	case CipherAES256GCM:
+		return 12, nil
+	case CipherXChaCha20Poly1305:
+		return chacha20poly1305.NonceSizeX, nil
+	default:
+		return 0, fmt.Errorf("unsupported cipher %v", c)
+	}
+}
+
+func newAEAD(c int, key []byte) (cipher.AEAD, error) {
+	switch c {
+	case CipherAES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case CipherXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	default:
+		return nil, fmt.Errorf("unsupported cipher %v", c)
+	}
+}
+
+// chunkStream seals or opens the chunks of an object in order
+type chunkStream struct {
+	aead   cipher.AEAD
+	header []byte
+	nonce  []byte
+	// prefix is the length of the random part of the nonce
+	prefix  int
+	counter uint32
+	done    bool
+}
+
+func newChunkStream(h *encryptionHeader, derived []byte) (*chunkStream, error) {
+	aead, err := newAEAD(int(h.cipher), derived)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkStream{
+		aead:   aead,
+		header: h.marshal(),
+		nonce:  append(append([]byte{}, h.noncePrefix...), make([]byte, nonceSuffixSize)...),
+		prefix: len(h.noncePrefix),
+	}, nil
+}
+
+// next returns the nonce of the next chunk. The counter prevents chunks being
+// reordered, and the final flag prevents content being truncated at a chunk boundary
+func (s *chunkStream) next(final bool) ([]byte, error) {
+	if s.done {
+		return nil, errors.New("chunk follows the final chunk")
+	}
+	if s.counter == ^uint32(0) {
+		return nil, errors.New("too many chunks")
+	}
+	binary.BigEndian.PutUint32(s.nonce[s.prefix:], s.counter)
+	s.nonce[len(s.nonce)-1] = 0
+	if final {
+		s.nonce[len(s.nonce)-1] = 1
+		s.done = true
+	}
+	s.counter++
+	return s.nonce, nil
+}
+
+// encryptReader encrypts its source as it is read
+type encryptReader struct {
+	src    *bufio.Reader
+	stream *chunkStream
+	plain  []byte
+	sealed []byte
+	out    []byte
+	err    error
+}
+
+// NewEncryptReader is used to encrypt r with key, returning a reader of the
+// encrypted content. Content is sealed in chunks, so it is never held in memory
+// in full, and the result can be decrypted with NewDecryptReader
+func NewEncryptReader(r io.Reader, key EncryptionKey, opts EncryptOpts) (io.Reader, error) {
+	h, err := newEncryptionHeader(key.kdf, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(h.salt); err != nil {
+		return nil, err
+	}
+	derived, err := key.derive(h.kdf, h.salt)
+	if err != nil {
+		return nil, err
+	}
+	return newEncryptReader(r, h, derived)
+}
+
+// newEncryptionHeader returns the header of a new object, with a random nonce
+// prefix and a zeroed salt, validating opts and filling in their defaults
+func newEncryptionHeader(kdf byte, opts EncryptOpts) (*encryptionHeader, error) {
+	if opts.Cipher == 0 {
+		opts.Cipher = CipherAES256GCM
+	}
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = DefaultEncryptionChunkSize
+	}
+	if opts.ChunkSize < 0 || opts.ChunkSize > MaxEncryptionChunkSize {
+		return nil, fmt.Errorf("chunk size must be between 1 and %v bytes", MaxEncryptionChunkSize)
+	}
+	nonceSize, err := cipherNonceSize(opts.Cipher)
+	if err != nil {
+		return nil, err
+	}
+	h := &encryptionHeader{
+		cipher:      byte(opts.Cipher),
+		kdf:         kdf,
+		chunkSize:   uint32(opts.ChunkSize),
+		salt:        make([]byte, kdfSaltSize(kdf)),
+		noncePrefix: make([]byte, nonceSize-nonceSuffixSize),
+	}
+	if _, err := rand.Read(h.noncePrefix); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// newEncryptReader is used to encrypt r as described by h, with the key derived for its salt
+func newEncryptReader(r io.Reader, h *encryptionHeader, derived []byte) (io.Reader, error) {
+	stream, err := newChunkStream(h, derived)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptReader{
+		src:    bufio.NewReader(r),
+		stream: stream,
+		plain:  make([]byte, h.chunkSize),
+		out:    append([]byte{}, stream.header...),
+	}, nil
+}
+
+func (e *encryptReader) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+		if e.stream.done {
+			e.err = io.EOF
+			continue
+		}
+		n, err := io.ReadFull(e.src, e.plain)
+		final := false
+		switch err {
+		case nil:
+			// a full chunk is only final if nothing follows it
+			if _, err := e.src.Peek(1); err == io.EOF {
+				final = true
+			} else if err != nil {
+				e.err = err
+				continue
+			}
+		case io.EOF, io.ErrUnexpectedEOF:
+			final = true
+		default:
+			e.err = err
+			continue
+		}
+		nonce, err := e.stream.next(final)
+		if err != nil {
+			e.err = err
+			continue
+		}
+		e.sealed = e.stream.aead.Seal(e.sealed[:0], nonce, e.plain[:n], e.stream.header)
+		e.out = e.sealed
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// decryptReader decrypts and authenticates its source as it is read
+type decryptReader struct {
+	src *bufio.Reader
+	// derive returns the key for the key derivation function and salt read from the header
+	derive func(kdf byte, salt []byte) ([]byte, error)
+	stream *chunkStream
+	sealed []byte
+	out    []byte
+	err    error
+}
+
+// NewDecryptReader is used to decrypt content encrypted by NewEncryptReader. The
+// header is read on the first call to Read. Each chunk is authenticated before it
+// is returned, and an error is returned if the content has been altered or truncated
+func NewDecryptReader(r io.Reader, key EncryptionKey) io.Reader {
+	return &decryptReader{src: bufio.NewReader(r), derive: key.derive}
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.open()
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// open decrypts the next chunk into out
+func (d *decryptReader) open() error {
+	if d.stream == nil {
+		h, err := readEncryptionHeader(d.src)
+		if err != nil {
+			return err
+		}
+		derived, err := d.derive(h.kdf, h.salt)
+		if err != nil {
+			return err
+		}
+		if d.stream, err = newChunkStream(h, derived); err != nil {
+			return err
+		}
+		d.sealed = make([]byte, int(h.chunkSize)+d.stream.aead.Overhead())
+		return nil
+	}
+	if d.stream.done {
+		return io.EOF
+	}
+	n, err := io.ReadFull(d.src, d.sealed)
+	final := false
+	switch err {
+	case nil:
+		if _, err := d.src.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		final = true
+	case io.EOF:
+		return errors.New("encrypted content is truncated")
+	default:
+		return err
+	}
+	counter := d.stream.counter
+	nonce, err := d.stream.next(final)
+	if err != nil {
+		return err
+	}
+	if d.out, err = d.stream.aead.Open(d.sealed[:0], nonce, d.sealed[:n], d.stream.header); err != nil {
+		return fmt.Errorf("failed to decrypt chunk %v: content has been altered, truncated or the key is wrong", counter)
+	}
+	return nil
+}
+
+// Encrypt is used to encrypt data with key
+func Encrypt(data []byte, key EncryptionKey, opts EncryptOpts) ([]byte, error) {
+	r, err := NewEncryptReader(bytes.NewReader(data), key, opts)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// Decrypt is used to decrypt data encrypted with Encrypt or NewEncryptReader
+func Decrypt(data []byte, key EncryptionKey) ([]byte, error) {
+	return ioutil.ReadAll(NewDecryptReader(bytes.NewReader(data), key))
+}
+
+// EncryptedManager is used to add content encrypted, and to read it back. Only
+// Add and Cat are provided, so that content can not reach the node unencrypted
+// through any other call
+type EncryptedManager struct {
+	im   Manager
+	key  EncryptionKey
+	opts EncryptOpts
+	// scryptSalt and master are the scrypt derivation of a passphrase key, shared
+	// by every object added so that scrypt is only run once
+	scryptSalt []byte
+	master     []byte
+}
+
+// NewEncryptedManager is used to wrap im so that content is encrypted with key before
+// it is sent to the node by Add, and decrypted by Cat. Encrypted objects are ordinary
+// ipfs content, and can be pinned and transferred with im as any other. Each object is
+// encrypted with its own key, derived with a random salt. Passphrase keys are stretched
+// with scrypt once, and the key of each object derived from the result
+func NewEncryptedManager(im Manager, key EncryptionKey, opts EncryptOpts) (*EncryptedManager, error) {
+	// validate the options and key up front, rather than on the first add
+	if _, err := newEncryptionHeader(key.kdf, opts); err != nil {
+		return nil, err
+	}
+	em := &EncryptedManager{im: im, key: key, opts: opts}
+	if key.kdf != kdfScrypt {
+		if _, err := key.derive(key.kdf, make([]byte, encryptionSaltSize)); err != nil {
+			return nil, err
+		}
+		return em, nil
+	}
+	if len(key.secret) == 0 {
+		return nil, errors.New("encryption key is empty")
+	}
+	em.scryptSalt = make([]byte, encryptionSaltSize)
+	if _, err := rand.Read(em.scryptSalt); err != nil {
+		return nil, err
+	}
+	var err error
+	if em.master, err = scrypt.Key(key.secret, em.scryptSalt, scryptN, scryptR, scryptP, encryptionKeySize); err != nil {
+		return nil, err
+	}
+	return em, nil
+}
+
+// Add is used to encrypt r and add it to ipfs
+func (em *EncryptedManager) Add(r io.Reader, options ...ipfsapi.AddOpts) (string, error) {
+	kdf := em.key.kdf
+	if kdf == kdfScrypt {
+		kdf = kdfScryptHKDF
+	}
+	h, err := newEncryptionHeader(kdf, em.opts)
+	if err != nil {
+		return "", err
+	}
+	if _, err := rand.Read(h.salt); err != nil {
+		return "", err
+	}
+	if kdf == kdfScryptHKDF {
+		copy(h.salt, em.scryptSalt)
+	}
+	derived, err := em.derive(h.kdf, h.salt)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := newEncryptReader(r, h, derived)
+	if err != nil {
+		return "", err
+	}
+	return em.im.Add(encrypted, options...)
+}
+
+// Cat is used to retrieve and decrypt an object added with Add
+func (em *EncryptedManager) Cat(cid string) ([]byte, error) {
+	data, err := em.im.Cat(cid)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(&decryptReader{src: bufio.NewReader(bytes.NewReader(data)), derive: em.derive})
+}
+
+// derive returns the key of an object, reusing the scrypt derivation made up front
+// for objects added by em
+func (em *EncryptedManager) derive(kdf byte, salt []byte) ([]byte, error) {
+	if kdf == kdfScryptHKDF && em.master != nil && bytes.Equal(salt[:encryptionSaltSize], em.scryptSalt) {
+		return hkdfKey(em.master, salt[encryptionSaltSize:])
+	}
+	return em.key.derive(kdf, salt)
+}
@@ -0,0 +1,227 @@
+package rtfs_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/RTradeLtd/rtfs/v2"
+	"github.com/RTradeLtd/rtfs/v2/rtfstest"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+func TestEncrypt(t *testing.T) {
+	km := newTestKeystoreManager(t)
+	if _, err := km.CreateAndSaveKey("encryption", ci.Ed25519, 256); err != nil {
+		t.Fatal(err)
+	}
+	keystoreKey, err := km.EncryptionKey("encryption")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const chunkSize = 1024
+	sizes := []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, chunkSize * 3}
+	tests := []struct {
+		name   string
+		key    rtfs.EncryptionKey
+		cipher int
+	}{
+		{"Keystore-AES", keystoreKey, rtfs.CipherAES256GCM},
+		{"Keystore-XChaCha", keystoreKey, rtfs.CipherXChaCha20Poly1305},
+		{"Passphrase-Default", rtfs.PassphraseKey("correct horse battery staple"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, size := range sizes {
+				data := make([]byte, size)
+				rand.Read(data)
+				encrypted, err := rtfs.Encrypt(data, tt.key, rtfs.EncryptOpts{Cipher: tt.cipher, ChunkSize: chunkSize})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if size > 16 && bytes.Contains(encrypted, data) {
+					t.Fatal("encrypted content contains the plaintext")
+				}
+				decrypted, err := rtfs.Decrypt(encrypted, tt.key)
+				if err != nil {
+					t.Fatalf("Decrypt() of %v bytes err = %v", size, err)
+				}
+				if !bytes.Equal(decrypted, data) {
+					t.Fatalf("Decrypt() of %v bytes returned different content", size)
+				}
+			}
+		})
+	}
+}
+
+func TestDecrypt_Invalid(t *testing.T) {
+	key := rtfs.PassphraseKey("passphrase")
+	const chunkSize = 1024
+	data := make([]byte, chunkSize*3)
+	rand.Read(data)
+	encrypted, err := rtfs.Encrypt(data, key, rtfs.EncryptOpts{ChunkSize: chunkSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the header of an aes-gcm object is 7+3+4+16+7 bytes, and each chunk adds a 16 byte tag
+	const headerSize, sealedSize = 37, chunkSize + 16
+	if len(encrypted) != headerSize+sealedSize*3 {
+		t.Fatalf("encrypted length = %v", len(encrypted))
+	}
+	tampered := append([]byte{}, encrypted...)
+	tampered[headerSize+10] ^= 1
+	alteredHeader := append([]byte{}, encrypted...)
+	alteredHeader[20] ^= 1
+	reordered := append(append(append([]byte{}, encrypted[:headerSize]...),
+		encrypted[headerSize+sealedSize:headerSize+sealedSize*2]...),
+		encrypted[headerSize:headerSize+sealedSize]...)
+	reordered = append(reordered, encrypted[headerSize+sealedSize*2:]...)
+	tests := []struct {
+		name string
+		data []byte
+		key  rtfs.EncryptionKey
+	}{
+		{"Wrong-Passphrase", encrypted, rtfs.PassphraseKey("wrong")},
+		{"Tampered", tampered, key},
+		{"Altered-Header", alteredHeader, key},
+		{"Reordered", reordered, key},
+		{"Truncated-At-Chunk", encrypted[:headerSize+sealedSize*2], key},
+		{"Truncated-In-Chunk", encrypted[:len(encrypted)-1], key},
+		{"Header-Only", encrypted[:headerSize], key},
+		{"Not-Encrypted", []byte("hello world, this is some plaintext content"), key},
+		{"Empty-Key", encrypted, rtfs.EncryptionKey{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := rtfs.Decrypt(tt.data, tt.key); err == nil {
+				t.Fatal("Decrypt() err = nil, wantErr true")
+			}
+		})
+	}
+}
+
+func TestNewEncryptReader(t *testing.T) {
+	key := rtfs.PassphraseKey("passphrase")
+	tests := []struct {
+		name    string
+		opts    rtfs.EncryptOpts
+		wantErr bool
+	}{
+		{"Default", rtfs.EncryptOpts{}, false},
+		{"Bad-Cipher", rtfs.EncryptOpts{Cipher: 10}, true},
+		{"Negative-Chunk-Size", rtfs.EncryptOpts{ChunkSize: -1}, true},
+		{"Large-Chunk-Size", rtfs.EncryptOpts{ChunkSize: rtfs.MaxEncryptionChunkSize + 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := rtfs.NewEncryptReader(strings.NewReader("hello"), key, tt.opts); (err != nil) != tt.wantErr {
+				t.Fatalf("NewEncryptReader() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncryptedManager(t *testing.T) {
+	const plaintext = "hello world, this content is private"
+	node := rtfstest.NewNode()
+	im, err := rtfs.NewEncryptedManager(node, rtfs.PassphraseKey("passphrase"), rtfs.EncryptOpts{Cipher: rtfs.CipherXChaCha20Poly1305})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashes []string
+	for i := 0; i < 2; i++ {
+		hash, err := im.Add(strings.NewReader(plaintext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if hashes[0] == hashes[1] {
+		t.Fatal("identical content was encrypted identically")
+	}
+	// objects share the scrypt salt, which follows the 14 byte fixed header,
+	// but each has its own salt and so its own key
+	first, _ := node.Cat(hashes[0])
+	second, _ := node.Cat(hashes[1])
+	if !bytes.Equal(first[14:30], second[14:30]) || bytes.Equal(first[30:46], second[30:46]) {
+		t.Fatal("objects do not have their own salts")
+	}
+	for _, hash := range hashes {
+		stored, err := node.Cat(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(stored, []byte(plaintext)) {
+			t.Fatal("node received plaintext")
+		}
+		if data, err := rtfs.Decrypt(stored, rtfs.PassphraseKey("passphrase")); err != nil || string(data) != plaintext {
+			t.Fatalf("Decrypt() = %s, %v, want %s", data, err, plaintext)
+		}
+		data, err := im.Cat(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != plaintext {
+			t.Fatalf("Cat() = %s, want %s", data, plaintext)
+		}
+	}
+	// content encrypted elsewhere with the same key is derived for its own salt
+	encrypted, err := rtfs.Encrypt([]byte(plaintext), rtfs.PassphraseKey("passphrase"), rtfs.EncryptOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := node.Add(bytes.NewReader(encrypted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := im.Cat(hash); err != nil || string(data) != plaintext {
+		t.Fatalf("Cat() = %s, %v, want %s", data, err, plaintext)
+	}
+	other, err := rtfs.NewEncryptedManager(node, rtfs.PassphraseKey("other"), rtfs.EncryptOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Cat(hashes[0]); err == nil {
+		t.Fatal("expected error decrypting with the wrong key")
+	}
+	if _, err := rtfs.NewEncryptedManager(node, rtfs.EncryptionKey{}, rtfs.EncryptOpts{}); err == nil {
+		t.Fatal("expected error for empty key")
+	}
+	if _, err := rtfs.NewEncryptedManager(node, rtfs.PassphraseKey("passphrase"), rtfs.EncryptOpts{Cipher: 10}); err == nil {
+		t.Fatal("expected error for unsupported cipher")
+	}
+}
+
+func TestEncryptedManager_KeystoreKey(t *testing.T) {
+	km := newTestKeystoreManager(t)
+	if _, err := km.CreateAndSaveKey("encryption", ci.Ed25519, 256); err != nil {
+		t.Fatal(err)
+	}
+	key, err := km.EncryptionKey("encryption")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := rtfstest.NewNode()
+	im, err := rtfs.NewEncryptedManager(node, key, rtfs.EncryptOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := im.Add(strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := im.Cat(hash); err != nil || string(data) != "hello" {
+		t.Fatalf("Cat() = %s, %v, want hello", data, err)
+	}
+	stored, err := node.Cat(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := rtfs.Decrypt(stored, key); err != nil || string(data) != "hello" {
+		t.Fatalf("Decrypt() = %s, %v, want hello", data, err)
+	}
+	if _, err := rtfs.Decrypt(stored, rtfs.PassphraseKey("passphrase")); err == nil {
+		t.Fatal("expected error decrypting with a passphrase")
+	}
+}
@@ -0,0 +1,246 @@
+package rtfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// envelopeSignaturePrefix is prepended to all signed envelope statements so that an
+// envelope signature can never be confused with a signature over arbitrary data
+const envelopeSignaturePrefix = "rtfs-pubsub-envelope"
+
+// envelope encodings
+const (
+	// EnvelopeJSON encodes envelopes as json, with binary fields base64 encoded
+	EnvelopeJSON = "json"
+	// EnvelopeCBOR encodes envelopes as cbor, which is more compact for binary data
+	EnvelopeCBOR = "cbor"
+)
+
+// Envelope wraps a pubsub message with its content type, the time it was
+// created, and optionally a signature so subscribers can verify the sender
+type Envelope struct {
+	Topic       string `json:"topic"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+	// Timestamp is the creation time in unix nanoseconds
+	Timestamp int64  `json:"timestamp"`
+	Signer    string `json:"signer,omitempty"`
+	PublicKey []byte `json:"public_key,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// NewEnvelope is used to create an unsigned envelope for data published to topic
+func NewEnvelope(topic, contentType string, data []byte) *Envelope {
+	return &Envelope{
+		Topic:       topic,
+		ContentType: contentType,
+		Data:        data,
+		Timestamp:   time.Now().UnixNano(),
+	}
+}
+
+// SignEnvelope is used to sign an envelope with the named key
+func (km *KeystoreManager) SignEnvelope(keyName string, env *Envelope) error {
+	pk, err := km.GetPrivateKeyByName(keyName)
+	if err != nil {
+		return err
+	}
+	id, err := peer.IDFromPrivateKey(pk)
+	if err != nil {
+		return err
+	}
+	pubBytes, err := pk.GetPublic().Bytes()
+	if err != nil {
+		return err
+	}
+	env.Signer = id.Pretty()
+	env.PublicKey = pubBytes
+	statement, err := env.statement()
+	if err != nil {
+		return err
+	}
+	env.Signature, err = pk.Sign(statement)
+	return err
+}
+
+// Signed returns whether or not the envelope carries a signature
+func (e *Envelope) Signed() bool {
+	return len(e.Signature) > 0
+}
+
+// Time returns the time the envelope was created
+func (e *Envelope) Time() time.Time {
+	return time.Unix(0, e.Timestamp)
+}
+
+// Verify is used to check that the envelope is signed, and
+// that the signature was produced by the key belonging to the signer
+func (e *Envelope) Verify() error {
+	if !e.Signed() {
+		return errors.New("envelope is not signed")
+	}
+	pub, err := ci.UnmarshalPublicKey(e.PublicKey)
+	if err != nil {
+		return err
+	}
+	id, err := peer.Decode(e.Signer)
+	if err != nil {
+		return err
+	}
+	if !id.MatchesPublicKey(pub) {
+		return errors.New("public key does not match signer")
+	}
+	statement, err := e.statement()
+	if err != nil {
+		return err
+	}
+	valid, err := pub.Verify(statement, e.Signature)
+	if err != nil {
+		return err
+	} else if !valid {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// Marshal is used to encode the envelope with either EnvelopeJSON or EnvelopeCBOR
+func (e *Envelope) Marshal(encoding string) ([]byte, error) {
+	switch encoding {
+	case EnvelopeJSON:
+		return json.Marshal(e)
+	case EnvelopeCBOR:
+		return cborEncode(e.fields(true))
+	default:
+		return nil, fmt.Errorf("unsupported envelope encoding '%s'", encoding)
+	}
+}
+
+// UnmarshalEnvelope is used to decode an envelope encoded as either json or cbor.
+// The encoding is detected from the first byte, as a cbor map never begins with '{'
+func UnmarshalEnvelope(data []byte) (*Envelope, error) {
+	if len(data) == 0 {
+		return nil, errors.New("envelope is empty")
+	}
+	env := new(Envelope)
+	if data[0] == '{' {
+		if err := json.Unmarshal(data, env); err != nil {
+			return nil, err
+		}
+		return env, nil
+	}
+	decoded, err := cborDecode(data)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("envelope is not a cbor map")
+	}
+	for name, value := range fields {
+		var ok bool
+		switch name {
+		case "topic":
+			env.Topic, ok = value.(string)
+		case "content_type":
+			env.ContentType, ok = value.(string)
+		case "data":
+			env.Data, ok = value.([]byte)
+		case "timestamp":
+			switch ts := value.(type) {
+			case uint64:
+				env.Timestamp, ok = int64(ts), true
+			case int64:
+				env.Timestamp, ok = ts, true
+			}
+		case "signer":
+			env.Signer, ok = value.(string)
+		case "public_key":
+			env.PublicKey, ok = value.([]byte)
+		case "signature":
+			env.Signature, ok = value.([]byte)
+		default:
+			ok = true
+		}
+		if !ok {
+			return nil, fmt.Errorf("envelope field '%s' has invalid type", name)
+		}
+	}
+	return env, nil
+}
+
+// OpenEnvelope is used to decode the envelope carried by a pubsub message. The
+// envelope must have been published to the topic the message was received on,
+// and if it is signed the signature must be valid. Unsigned envelopes are accepted,
+// so callers relying on the sender must check Signed, or use OpenSignedEnvelope
+func OpenEnvelope(msg Message) (*Envelope, error) {
+	env, err := UnmarshalEnvelope(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+	if env.Topic != msg.Topic {
+		return nil, fmt.Errorf("envelope for topic '%s' received on '%s'", env.Topic, msg.Topic)
+	}
+	if env.Signed() {
+		if err := env.Verify(); err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+// OpenSignedEnvelope is used to decode the envelope carried by a pubsub message as
+// OpenEnvelope does, additionally requiring it to be signed. The signer should still
+// be checked against the senders the caller trusts
+func OpenSignedEnvelope(msg Message) (*Envelope, error) {
+	env, err := OpenEnvelope(msg)
+	if err != nil {
+		return nil, err
+	}
+	if !env.Signed() {
+		return nil, errors.New("envelope is not signed")
+	}
+	return env, nil
+}
+
+// PublishEnvelope is used to encode an envelope and publish it to its topic
+func PublishEnvelope(im Manager, env *Envelope, encoding string) error {
+	data, err := env.Marshal(encoding)
+	if err != nil {
+		return err
+	}
+	return im.PubSubPublishBytes(env.Topic, data)
+}
+
+// fields returns the envelope as a cbor map, optionally including the signature
+func (e *Envelope) fields(withSignature bool) map[string]interface{} {
+	fields := map[string]interface{}{
+		"topic":        e.Topic,
+		"content_type": e.ContentType,
+		"data":         e.Data,
+		"timestamp":    e.Timestamp,
+	}
+	if e.Signer != "" {
+		fields["signer"] = e.Signer
+		fields["public_key"] = e.PublicKey
+	}
+	if withSignature && e.Signed() {
+		fields["signature"] = e.Signature
+	}
+	return fields
+}
+
+// statement returns the bytes that are signed, which cover every field but the
+// signature, and are identical regardless of how the envelope is encoded
+func (e *Envelope) statement() ([]byte, error) {
+	encoded, err := cborEncode(e.fields(false))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(envelopeSignaturePrefix+"\n"), encoded...), nil
+}
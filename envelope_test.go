@@ -0,0 +1,88 @@
+package rtfs_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/RTradeLtd/rtfs/v2"
+)
+
+func TestEnvelope(t *testing.T) {
+	km := newTestKeystoreManager(t)
+	if _, err := km.CreateAndSaveKey("sender", rtfs.KeyTypeEd25519, 0); err != nil {
+		t.Fatal(err)
+	}
+	var published [][]byte
+	im := newFakeNode(t, map[string]http.HandlerFunc{
+		"pubsub/pub": func(w http.ResponseWriter, r *http.Request) {
+			args := r.URL.Query()["arg"]
+			if len(args) != 2 || args[0] != "topic" {
+				t.Errorf("bad arguments %q", args)
+				return
+			}
+			published = append(published, []byte(args[1]))
+		},
+	})
+	if err := im.PubSubPublishBytes("", []byte("data")); err == nil {
+		t.Fatal("expected error publishing to empty topic")
+	}
+	// empty messages are published as is
+	if err := im.PubSubPublishBytes("topic", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 1 || len(published[0]) != 0 {
+		t.Fatal("empty message not published")
+	}
+	payload := []byte{0, 1, '\n', 2, 0xff}
+	for _, encoding := range []string{rtfs.EnvelopeJSON, rtfs.EnvelopeCBOR} {
+		t.Run(encoding, func(t *testing.T) {
+			published = nil
+			env := rtfs.NewEnvelope("topic", "application/octet-stream", payload)
+			if err := env.Verify(); err == nil {
+				t.Fatal("expected error verifying unsigned envelope")
+			}
+			if err := km.SignEnvelope("sender", env); err != nil {
+				t.Fatal(err)
+			}
+			if err := rtfs.PublishEnvelope(im, env, encoding); err != nil {
+				t.Fatal(err)
+			}
+			if len(published) != 1 {
+				t.Fatal("envelope not published")
+			}
+			got, err := rtfs.OpenSignedEnvelope(rtfs.Message{Topic: "topic", Data: published[0]})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Signed() || got.Signer != env.Signer || got.ContentType != env.ContentType ||
+				!bytes.Equal(got.Data, payload) || !got.Time().Equal(env.Time()) {
+				t.Fatal("bad envelope opened")
+			}
+			if _, err := rtfs.OpenEnvelope(rtfs.Message{Topic: "other", Data: published[0]}); err == nil {
+				t.Fatal("expected error opening envelope from another topic")
+			}
+			got.Data = []byte("tampered")
+			tampered, err := got.Marshal(encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rtfs.OpenEnvelope(rtfs.Message{Topic: "topic", Data: tampered}); err == nil {
+				t.Fatal("expected error opening tampered envelope")
+			}
+		})
+	}
+	unsigned, err := rtfs.NewEnvelope("topic", "text/plain", payload).Marshal(rtfs.EnvelopeJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rtfs.OpenEnvelope(rtfs.Message{Topic: "topic", Data: unsigned}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rtfs.OpenSignedEnvelope(rtfs.Message{Topic: "topic", Data: unsigned}); err == nil {
+		t.Fatal("expected error opening unsigned envelope with OpenSignedEnvelope")
+	}
+	if _, err := rtfs.NewEnvelope("topic", "", payload).Marshal("xml"); err == nil {
+		t.Fatal("expected error for unsupported encoding")
+	}
+}
@@ -1,5 +1,7 @@
 package rtfs
 
+import "errors"
+
 // non-class functions
 
 // DedupAndCalculatePinSize is used to remove duplicate refers to objects for a more accurate pin size cost
@@ -26,3 +28,16 @@ func DedupAndCalculatePinSize(hash string, im Manager) (int64, []string, error)
 	}
 	return int64(totalDataSize), refs, nil
 }
+
+// TopicHasPeers is used to check whether any peers are currently subscribed to a topic,
+// so that messages published to it will be received by someone
+func TopicHasPeers(topic string, im Manager) (bool, error) {
+	if topic == "" {
+		return false, errors.New("topic is empty")
+	}
+	peers, err := im.PubSubPeers(topic)
+	if err != nil {
+		return false, err
+	}
+	return len(peers) > 0, nil
+}
@@ -1,12 +1,19 @@
 module github.com/RTradeLtd/rtfs/v2
 
-go 1.14
+go 1.16
 
 require (
 	github.com/RTradeLtd/config/v2 v2.2.0
 	github.com/RTradeLtd/entropy-mnemonics v0.0.0-20170316012907-7b01a644a636
 	github.com/RTradeLtd/go-ipfs-api/v3 v3.0.0
 	github.com/RTradeLtd/krab/v4 v4.0.0
+	github.com/gogo/protobuf v1.3.1
+	github.com/ipfs/go-cid v0.0.5
 	github.com/ipfs/go-datastore v0.4.4
+	github.com/ipfs/go-ipfs-files v0.0.8
 	github.com/libp2p/go-libp2p-core v0.5.1
+	github.com/multiformats/go-multibase v0.0.1
+	github.com/multiformats/go-multihash v0.0.13
+	github.com/spaolacci/murmur3 v1.1.0
+	golang.org/x/crypto v0.0.0-20190611184440-5c40567a22f8
 )
@@ -0,0 +1,115 @@
+package rtfs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is a single compiled .gitignore style pattern
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRules matches paths against .gitignore style patterns, where the
+// last matching pattern decides whether or not a path is excluded
+type ignoreRules []ignoreRule
+
+// compileIgnoreRules compiles .gitignore style patterns. Blank lines and
+// lines beginning with # are skipped, ! negates a pattern, a trailing / only
+// matches directories, and patterns containing a / are relative to the root,
+// while those without one match at any depth. * and ? do not match /, while
+// ** matches across directories
+func compileIgnoreRules(patterns []string) (ignoreRules, error) {
+	var rules ignoreRules
+	for _, pattern := range patterns {
+		pattern = strings.TrimRight(pattern, " \t\r")
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(pattern, "!") {
+			rule.negate, pattern = true, pattern[1:]
+		} else if strings.HasPrefix(pattern, `\`) {
+			pattern = pattern[1:]
+		}
+		if strings.HasSuffix(pattern, "/") {
+			rule.dirOnly, pattern = true, strings.TrimRight(pattern, "/")
+		}
+		if pattern == "" {
+			continue
+		}
+		anchored := strings.Contains(pattern, "/")
+		pattern = strings.TrimPrefix(pattern, "/")
+		expr := ignorePatternToRegexp(pattern)
+		if !anchored {
+			expr = "(.*/)?" + expr
+		}
+		re, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern '%s': %s", pattern, err.Error())
+		}
+		rule.re = re
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// excluded returns whether or not rel, a slash separated path relative to the root, is excluded
+func (r ignoreRules) excluded(rel string, isDir bool) bool {
+	excluded := false
+	for _, rule := range r {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(rel) {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
+
+func ignorePatternToRegexp(pattern string) string {
+	var expr strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**") {
+				switch {
+				case strings.HasPrefix(pattern[i:], "**/"):
+					// zero or more leading directories
+					expr.WriteString("(.*/)?")
+					i += 2
+				default:
+					expr.WriteString(".*")
+					i++
+				}
+				continue
+			}
+			expr.WriteString("[^/]*")
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			if end := strings.IndexByte(pattern[i+1:], ']'); end >= 0 {
+				class := pattern[i+1 : i+1+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				expr.WriteString("[" + class + "]")
+				i += end + 1
+				continue
+			}
+			expr.WriteString(`\[`)
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expr.String()
+}
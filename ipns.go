@@ -0,0 +1,366 @@
+package rtfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// ipnsSignatureV2Prefix is prepended to the record data before creating a V2 signature
+const ipnsSignatureV2Prefix = "ipns-signature:"
+
+// ipnsValidityEOL is the only validity type supported by ipns
+const ipnsValidityEOL = 0
+
+// ipnsValidityFormat is the RFC3339 layout ipns uses for validity, which
+// unlike time.RFC3339Nano always writes nine digits of nanoseconds
+const ipnsValidityFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// IPNS signature types, describing which signatures a record carries
+const (
+	IPNSSignatureV1   = "V1"
+	IPNSSignatureV2   = "V2"
+	IPNSSignatureV1V2 = "V1+V2"
+)
+
+// ipnsEntry is the IpnsEntry protobuf message records are exchanged as
+type ipnsEntry struct {
+	Value        []byte  `protobuf:"bytes,1,opt,name=value"`
+	SignatureV1  []byte  `protobuf:"bytes,2,opt,name=signatureV1"`
+	ValidityType *int32  `protobuf:"varint,3,opt,name=validityType"`
+	Validity     []byte  `protobuf:"bytes,4,opt,name=validity"`
+	Sequence     *uint64 `protobuf:"varint,5,opt,name=sequence"`
+	TTL          *uint64 `protobuf:"varint,6,opt,name=ttl"`
+	PubKey       []byte  `protobuf:"bytes,7,opt,name=pubKey"`
+	SignatureV2  []byte  `protobuf:"bytes,8,opt,name=signatureV2"`
+	Data         []byte  `protobuf:"bytes,9,opt,name=data"`
+}
+
+func (e *ipnsEntry) Reset()         { *e = ipnsEntry{} }
+func (e *ipnsEntry) String() string { return proto.CompactTextString(e) }
+func (*ipnsEntry) ProtoMessage()    {}
+
+// IPNSValidationError is returned when a retrieved IPNS record is malformed,
+// has expired, or was not signed by the key belonging to its name
+type IPNSValidationError struct {
+	Name string
+	Err  error
+}
+
+func (e *IPNSValidationError) Error() string {
+	return fmt.Sprintf("invalid ipns record for '%s': %s", e.Name, e.Err.Error())
+}
+
+// Unwrap returns the underlying validation failure
+func (e *IPNSValidationError) Unwrap() error { return e.Err }
+
+// IPNSRecord is a signed IPNS record, which can be created locally
+// with keys from a KeystoreManager and pushed to the network without
+// the ipfs node ever holding the private key
+type IPNSRecord struct {
+	// Value is the path the record points to, such as /ipfs/<cid>
+	Value string
+	// Sequence must be greater than that of any previous record for the name
+	Sequence uint64
+	// Validity is the time after which the record is no longer valid
+	Validity time.Time
+	// TTL is a hint for how long the record may be cached
+	TTL time.Duration
+	// PublicKey is only embedded when it can not be extracted from the name
+	PublicKey   ci.PubKey
+	SignatureV1 []byte
+	SignatureV2 []byte
+	// SignatureType is the set of signatures the record carries, such as IPNSSignatureV1V2
+	SignatureType string
+	// KeyType is the type of key the record is signed with, such as Ed25519. Keys
+	// not embedded in the record are only known once it is validated against a name
+	KeyType string
+	// Data is the dag-cbor encoded record fields covered by SignatureV2
+	Data []byte
+}
+
+// NewIPNSRecord is used to create an IPNS record pointing to value,
+// signed with both V1 and V2 signatures by the given key
+func NewIPNSRecord(pk ci.PrivKey, value string, seq uint64, eol time.Time, ttl time.Duration) (*IPNSRecord, error) {
+	record := &IPNSRecord{
+		Value:    normalizeIPNSValue(value),
+		Sequence: seq,
+		Validity: eol.UTC(),
+		TTL:      ttl,
+	}
+	var err error
+	if record.Data, err = record.dataForSignatureV2(); err != nil {
+		return nil, err
+	}
+	if record.SignatureV2, err = pk.Sign(append([]byte(ipnsSignatureV2Prefix), record.Data...)); err != nil {
+		return nil, err
+	}
+	if record.SignatureV1, err = pk.Sign(record.dataForSignatureV1()); err != nil {
+		return nil, err
+	}
+	// keys which can not be extracted from the peer id must be embedded
+	id, err := peer.IDFromPublicKey(pk.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+	if extracted, err := id.ExtractPublicKey(); err != nil || extracted == nil {
+		record.PublicKey = pk.GetPublic()
+	}
+	record.SignatureType = ipnsSignatureType(record)
+	record.KeyType = pk.Type().String()
+	return record, nil
+}
+
+// Marshal is used to encode the record as an IpnsEntry protobuf
+func (r *IPNSRecord) Marshal() ([]byte, error) {
+	validityType, ttl := int32(ipnsValidityEOL), uint64(r.TTL)
+	entry := &ipnsEntry{
+		Value:        []byte(r.Value),
+		SignatureV1:  r.SignatureV1,
+		ValidityType: &validityType,
+		Validity:     []byte(formatIPNSValidity(r.Validity)),
+		Sequence:     &r.Sequence,
+		TTL:          &ttl,
+		SignatureV2:  r.SignatureV2,
+		Data:         r.Data,
+	}
+	if r.PublicKey != nil {
+		pubBytes, err := r.PublicKey.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		entry.PubKey = pubBytes
+	}
+	return proto.Marshal(entry)
+}
+
+// UnmarshalIPNSRecord is used to decode an IpnsEntry protobuf. The
+// record is not validated, see IPNSRecord.Validate for that
+func UnmarshalIPNSRecord(data []byte) (*IPNSRecord, error) {
+	var entry ipnsEntry
+	if err := proto.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("ipns: malformed record: %s", err.Error())
+	}
+	if entry.ValidityType != nil && *entry.ValidityType != ipnsValidityEOL {
+		return nil, errors.New("ipns: unsupported validity type")
+	}
+	record := &IPNSRecord{
+		Value:       string(entry.Value),
+		SignatureV1: entry.SignatureV1,
+		SignatureV2: entry.SignatureV2,
+		Data:        entry.Data,
+	}
+	if entry.Sequence != nil {
+		record.Sequence = *entry.Sequence
+	}
+	if entry.TTL != nil {
+		record.TTL = time.Duration(*entry.TTL)
+	}
+	var err error
+	if len(entry.Validity) > 0 {
+		if record.Validity, err = parseIPNSValidity(entry.Validity); err != nil {
+			return nil, err
+		}
+	}
+	if len(entry.PubKey) > 0 {
+		if record.PublicKey, err = ci.UnmarshalPublicKey(entry.PubKey); err != nil {
+			return nil, err
+		}
+		record.KeyType = record.PublicKey.Type().String()
+	}
+	record.SignatureType = ipnsSignatureType(record)
+	if len(record.Data) > 0 && record.Value == "" {
+		// records with only a V2 signature carry their fields in the data
+		if err := record.fillFromData(); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// PublicKeyFor returns the key used to verify the record published under id
+func (r *IPNSRecord) PublicKeyFor(id peer.ID) (ci.PubKey, error) {
+	if r.PublicKey != nil {
+		if !id.MatchesPublicKey(r.PublicKey) {
+			return nil, errors.New("ipns: embedded public key does not match name")
+		}
+		return r.PublicKey, nil
+	}
+	pub, err := id.ExtractPublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("ipns: record has no public key, and it can not be extracted from the name: %s", err.Error())
+	}
+	return pub, nil
+}
+
+// Validate is used to check that the record was signed by the key belonging to id,
+// and has not expired. V2 signatures are preferred, falling back to V1 for older records
+func (r *IPNSRecord) Validate(id peer.ID) error {
+	pub, err := r.PublicKeyFor(id)
+	if err != nil {
+		return err
+	}
+	if len(r.SignatureV2) > 0 {
+		valid, err := pub.Verify(append([]byte(ipnsSignatureV2Prefix), r.Data...), r.SignatureV2)
+		if err != nil {
+			return err
+		} else if !valid {
+			return errors.New("ipns: invalid v2 signature")
+		}
+		if err := r.checkData(); err != nil {
+			return err
+		}
+	} else {
+		valid, err := pub.Verify(r.dataForSignatureV1(), r.SignatureV1)
+		if err != nil {
+			return err
+		} else if !valid {
+			return errors.New("ipns: invalid v1 signature")
+		}
+	}
+	if time.Now().After(r.Validity) {
+		return fmt.Errorf("ipns: record expired at %s", formatIPNSValidity(r.Validity))
+	}
+	return nil
+}
+
+// checkData ensures the fields covered by the V2 signature match the record
+func (r *IPNSRecord) checkData() error {
+	signed := &IPNSRecord{Data: r.Data}
+	if err := signed.fillFromData(); err != nil {
+		return err
+	}
+	if signed.Value != r.Value || signed.Sequence != r.Sequence ||
+		signed.TTL != r.TTL || !signed.Validity.Equal(r.Validity) {
+		return errors.New("ipns: record fields do not match signed data")
+	}
+	return nil
+}
+
+// fillFromData populates the record fields from the V2 signature data
+func (r *IPNSRecord) fillFromData() error {
+	decoded, err := cborDecode(r.Data)
+	if err != nil {
+		return err
+	}
+	fields, ok := decoded.(map[string]interface{})
+	if !ok {
+		return errors.New("ipns: record data is not a map")
+	}
+	value, _ := fields["Value"].([]byte)
+	validity, _ := fields["Validity"].([]byte)
+	seq, _ := fields["Sequence"].(uint64)
+	ttl, _ := fields["TTL"].(uint64)
+	r.Value, r.Sequence, r.TTL = string(value), seq, time.Duration(ttl)
+	r.Validity, err = parseIPNSValidity(validity)
+	return err
+}
+
+// dataForSignatureV1 returns the bytes covered by the V1 signature
+func (r *IPNSRecord) dataForSignatureV1() []byte {
+	return bytes.Join([][]byte{
+		[]byte(r.Value),
+		[]byte(formatIPNSValidity(r.Validity)),
+		[]byte("EOL"),
+	}, nil)
+}
+
+// dataForSignatureV2 returns the dag-cbor encoded record fields covered by the V2 signature
+func (r *IPNSRecord) dataForSignatureV2() ([]byte, error) {
+	return cborEncode(map[string]interface{}{
+		"Value":        []byte(r.Value),
+		"Validity":     []byte(formatIPNSValidity(r.Validity)),
+		"ValidityType": ipnsValidityEOL,
+		"Sequence":     r.Sequence,
+		"TTL":          uint64(r.TTL),
+	})
+}
+
+// CreateIPNSRecord is used to create an IPNS record for value, signed by the named key
+func (km *KeystoreManager) CreateIPNSRecord(keyName, value string, seq uint64, lifetime, ttl time.Duration) (*IPNSRecord, error) {
+	pk, err := km.GetPrivateKeyByName(keyName)
+	if err != nil {
+		return nil, err
+	}
+	return NewIPNSRecord(pk, value, seq, time.Now().Add(lifetime), ttl)
+}
+
+// PublishIPNSRecord is used to publish an IPNS record signed locally by the named key,
+// so that the key never has to be held by the ipfs node. The sequence number is
+// taken from the current record for the name, if there is one
+func PublishIPNSRecord(im Manager, km *KeystoreManager, keyName, contentHash string, lifetime, ttl time.Duration) (*IPNSRecord, error) {
+	pk, err := km.GetPrivateKeyByName(keyName)
+	if err != nil {
+		return nil, err
+	}
+	id, err := peer.IDFromPrivateKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	key := "/ipns/" + id.Pretty()
+	var seq uint64
+	current, err := im.RoutingGet(key)
+	switch {
+	case err == nil:
+		record, err := UnmarshalIPNSRecord(current)
+		if err != nil {
+			return nil, err
+		}
+		seq = record.Sequence + 1
+	case !errors.Is(err, ErrRoutingNotFound):
+		return nil, err
+	}
+	record, err := NewIPNSRecord(pk, contentHash, seq, time.Now().Add(lifetime), ttl)
+	if err != nil {
+		return nil, err
+	}
+	data, err := record.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if err := im.RoutingPut(key, data); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// ipnsSignatureType describes the signatures carried by record
+func ipnsSignatureType(record *IPNSRecord) string {
+	switch {
+	case len(record.SignatureV1) > 0 && len(record.SignatureV2) > 0:
+		return IPNSSignatureV1V2
+	case len(record.SignatureV2) > 0:
+		return IPNSSignatureV2
+	case len(record.SignatureV1) > 0:
+		return IPNSSignatureV1
+	}
+	return ""
+}
+
+// formatIPNSValidity formats validity the way ipns expects it
+func formatIPNSValidity(t time.Time) string {
+	return t.UTC().Format(ipnsValidityFormat)
+}
+
+// parseIPNSValidity parses a validity, accepting any number of fractional second digits
+func parseIPNSValidity(validity []byte) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, string(validity))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ipns: invalid validity: %s", err.Error())
+	}
+	return t, nil
+}
+
+// normalizeIPNSValue turns a bare cid into an /ipfs/ path
+func normalizeIPNSValue(value string) string {
+	if strings.HasPrefix(value, "/") {
+		return value
+	}
+	return "/ipfs/" + value
+}
@@ -0,0 +1,306 @@
+package rtfs_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/rtfs/v2"
+	"github.com/RTradeLtd/rtfs/v2/rtfstest"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestIPNSRecord(t *testing.T) {
+	tests := []struct {
+		name     string
+		keyType  int
+		bits     int
+		embedded bool
+	}{
+		{"Ed25519", rtfs.KeyTypeEd25519, 0, false},
+		{"RSA", rtfs.KeyTypeRSA, 2048, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pk, _, err := ci.GenerateKeyPair(tt.keyType, tt.bits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			eol := time.Now().Add(time.Hour)
+			record, err := rtfs.NewIPNSRecord(pk, testPIN, 10, eol, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.Value != "/ipfs/"+testPIN {
+				t.Fatal("value not normalized")
+			}
+			if (record.PublicKey != nil) != tt.embedded {
+				t.Fatal("public key embedded incorrectly")
+			}
+			data, err := record.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := rtfs.UnmarshalIPNSRecord(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Value != record.Value || decoded.Sequence != 10 ||
+				decoded.TTL != time.Minute || !decoded.Validity.Equal(eol) {
+				t.Fatalf("decoded record does not match %+v", decoded)
+			}
+			if valid, err := pk.GetPublic().Verify(append([]byte("ipns-signature:"), decoded.Data...), decoded.SignatureV2); err != nil {
+				t.Fatal(err)
+			} else if !valid {
+				t.Fatal("invalid v2 signature")
+			}
+			if _, err := rtfs.UnmarshalIPNSRecord(data[:len(data)-1]); err == nil {
+				t.Fatal("expected error decoding truncated record")
+			}
+		})
+	}
+}
+
+func TestPublishIPNSRecord(t *testing.T) {
+	km := newTestKeystoreManager(t)
+	if _, err := km.CreateAndSaveKey("ipns", ci.Ed25519, 256); err != nil {
+		t.Fatal(err)
+	}
+	node := rtfstest.NewNode()
+	for i, value := range []string{testPIN, "/ipfs/" + testRefsHash} {
+		record, err := rtfs.PublishIPNSRecord(node, km, "ipns", value, time.Hour, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Sequence != uint64(i) {
+			t.Fatalf("bad sequence %v, want %v", record.Sequence, i)
+		}
+	}
+	keys := node.Calls("RoutingPut")
+	if len(keys) != 2 || keys[0] != keys[1] {
+		t.Fatal("records stored under different keys")
+	}
+	data, err := node.RoutingGet(keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := rtfs.UnmarshalIPNSRecord(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Value != "/ipfs/"+testRefsHash {
+		t.Fatal("bad value stored")
+	}
+
+	// errors other than a missing record must not reset the sequence
+	node.Fail("RoutingGet", errors.New("connection refused"))
+	if _, err := rtfs.PublishIPNSRecord(node, km, "ipns", testPIN, time.Hour, time.Minute); err == nil {
+		t.Fatal("expected error when the current record can not be retrieved")
+	}
+	if len(node.Calls("RoutingPut")) != 2 {
+		t.Fatal("record published without the current sequence")
+	}
+}
+
+func TestIPNSRecord_ValidityFormat(t *testing.T) {
+	pk, _, err := ci.GenerateKeyPair(ci.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eol := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	record, err := rtfs.NewIPNSRecord(pk, testPIN, 0, eol, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := record.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// trailing zeros are kept, as in records created by go-ipns
+	if !bytes.Contains(data, []byte("2030-01-02T03:04:05.000000000Z")) {
+		t.Fatal("validity not encoded with nanosecond precision")
+	}
+}
+
+func TestIPNSRecord_Validate(t *testing.T) {
+	pk, _, err := ci.GenerateKeyPair(ci.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := ci.GenerateKeyPair(ci.RSA, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherID, err := peer.IDFromPrivateKey(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		record  func() *rtfs.IPNSRecord
+		id      peer.ID
+		wantErr bool
+	}{
+		{"Valid", func() *rtfs.IPNSRecord {
+			record, _ := rtfs.NewIPNSRecord(pk, testPIN, 1, time.Now().Add(time.Hour), time.Minute)
+			return record
+		}, id, false},
+		{"Wrong-Name", func() *rtfs.IPNSRecord {
+			record, _ := rtfs.NewIPNSRecord(pk, testPIN, 1, time.Now().Add(time.Hour), time.Minute)
+			return record
+		}, otherID, true},
+		{"Expired", func() *rtfs.IPNSRecord {
+			record, _ := rtfs.NewIPNSRecord(pk, testPIN, 1, time.Now().Add(-time.Hour), time.Minute)
+			return record
+		}, id, true},
+		{"Tampered-Value", func() *rtfs.IPNSRecord {
+			record, _ := rtfs.NewIPNSRecord(pk, testPIN, 1, time.Now().Add(time.Hour), time.Minute)
+			record.Value = "/ipfs/" + testRefsHash
+			return record
+		}, id, true},
+		{"V1-Only", func() *rtfs.IPNSRecord {
+			record, _ := rtfs.NewIPNSRecord(pk, testPIN, 1, time.Now().Add(time.Hour), time.Minute)
+			record.SignatureV2, record.Data = nil, nil
+			return record
+		}, id, false},
+		{"Embedded-Key", func() *rtfs.IPNSRecord {
+			record, _ := rtfs.NewIPNSRecord(other, testPIN, 1, time.Now().Add(time.Hour), time.Minute)
+			return record
+		}, otherID, false},
+		{"Embedded-Key-Wrong-Name", func() *rtfs.IPNSRecord {
+			record, _ := rtfs.NewIPNSRecord(other, testPIN, 1, time.Now().Add(time.Hour), time.Minute)
+			return record
+		}, id, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := tt.record()
+			data, err := record.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := rtfs.UnmarshalIPNSRecord(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := decoded.Validate(tt.id); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetIPNSRecord(t *testing.T) {
+	im, err := rtfs.NewManager(nodeOneAPIAddr, "", time.Minute*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	km := newTestKeystoreManager(t)
+	pk, err := km.CreateAndSaveKey("ipns", ci.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rtfs.PublishIPNSRecord(im, km, "ipns", testPIN, time.Hour, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	record, err := im.GetIPNSRecord("/ipns/" + id.Pretty())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Value != "/ipfs/"+testPIN {
+		t.Fatal("bad record value")
+	}
+}
+
+func TestGetIPNSRecord_Validation(t *testing.T) {
+	pk, _, err := ci.GenerateKeyPair(ci.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		eol     time.Time
+		wantErr bool
+	}{
+		{"Valid", time.Now().Add(time.Hour), false},
+		{"Expired", time.Now().Add(-time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, err := rtfs.NewIPNSRecord(pk, testPIN, 1, tt.eol, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := record.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			im := newFakeNode(t, map[string]http.HandlerFunc{
+				"routing/get": func(w http.ResponseWriter, r *http.Request) {
+					fmt.Fprintf(w, `{"Type":5,"Extra":"%s"}`, base64.StdEncoding.EncodeToString(data))
+				},
+			})
+			got, err := im.GetIPNSRecord(id.Pretty())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetIPNSRecord() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if got != nil {
+					t.Fatal("invalid record returned")
+				}
+				return
+			}
+			if got.SignatureType != rtfs.IPNSSignatureV1V2 || got.KeyType != "Ed25519" {
+				t.Fatalf("bad signature type %v or key type %v", got.SignatureType, got.KeyType)
+			}
+		})
+	}
+}
+
+func TestRoutingGet_NotFound(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+	}{
+		{"Error-Response", http.StatusInternalServerError, `{"Message":"routing: not found","Code":0,"Type":"error"}`, rtfs.ErrRoutingNotFound},
+		{"No-Value", http.StatusOK, `{"Type":0,"Extra":""}`, rtfs.ErrRoutingNotFound},
+		{"Other-Error", http.StatusInternalServerError, `{"Message":"failed to find any peer in table","Code":0,"Type":"error"}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			im := newFakeNode(t, map[string]http.HandlerFunc{
+				"routing/get": func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(tt.status)
+					w.Write([]byte(tt.body))
+				},
+			})
+			_, err := im.RoutingGet("/ipns/name")
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if errors.Is(err, rtfs.ErrRoutingNotFound) != (tt.wantErr != nil) {
+				t.Fatalf("RoutingGet() err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
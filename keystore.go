@@ -13,6 +13,9 @@ import (
 // KeystoreManager is howe we manipulat keys
 type KeystoreManager struct {
 	store *krab.Keystore
+	// audit is nil unless auditing is enabled with WithAudit
+	audit     *auditor
+	principal string
 }
 
 // NewKeystoreManager instantiates a new keystore manager. Takes an optional
@@ -30,7 +33,14 @@ func (km *KeystoreManager) CheckIfKeyExists(keyName string) (bool, error) {
 
 // GetPrivateKeyByName is used to get a private key by its name
 func (km *KeystoreManager) GetPrivateKeyByName(keyName string) (ci.PrivKey, error) {
-	return km.store.Get(keyName)
+	var pk ci.PrivKey
+	if err := km.audited(keyName, AuditAccess, func() (err error) {
+		pk, err = km.store.Get(keyName)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return pk, nil
 }
 
 // ListKeyIdentifiers will list out all key IDs (aka, public hashes)
@@ -40,32 +50,59 @@ func (km *KeystoreManager) ListKeyIdentifiers() ([]string, error) {
 
 // SavePrivateKey is used to save a private key under the specified name
 func (km *KeystoreManager) SavePrivateKey(keyName string, pk ci.PrivKey) error {
-	return km.store.Put(keyName, pk)
+	return km.audited(keyName, AuditCreate, func() error {
+		return km.store.Put(keyName, pk)
+	})
 }
 
-// CreateAndSaveKey is used to create a key of the given type and size
+// DeleteKey is used to remove the named key from the keystore
+func (km *KeystoreManager) DeleteKey(keyName string) error {
+	return km.audited(keyName, AuditDelete, func() error {
+		return km.store.Delete(keyName)
+	})
+}
+
+// supported key types
+const (
+	// KeyTypeRSA is used to create RSA keys, and requires at least MinRSAKeyBits
+	KeyTypeRSA = ci.RSA
+	// KeyTypeEd25519 is used to create Ed25519 keys
+	KeyTypeEd25519 = ci.Ed25519
+	// KeyTypeSecp256k1 is used to create Secp256k1 keys, which are compatible with ethereum tooling
+	KeyTypeSecp256k1 = ci.Secp256k1
+	// KeyTypeECDSA is used to create ECDSA keys on the P-256 curve
+	KeyTypeECDSA = ci.ECDSA
+)
+
+// MinRSAKeyBits is the smallest RSA key size we will create
+const MinRSAKeyBits = 2048
+
+// CreateAndSaveKey is used to create a key of the given type and size.
+// The size is only respected for RSA keys, all other key types have a fixed size
 func (km *KeystoreManager) CreateAndSaveKey(keyName string, keyType, bits int) (ci.PrivKey, error) {
-	if present, err := km.store.Has(keyName); err == nil {
-		return nil, fmt.Errorf("failed to check for key '%s': %s", keyName, err.Error())
-	} else if present {
+	// krab returns an error when the key does not exist
+	present, err := km.store.Has(keyName)
+	if err != nil && err.Error() != krab.ErrNoSuchKey {
+		return nil, err
+	}
+	if present {
 		return nil, errors.New("key name already exists")
 	}
-	var pk ci.PrivKey
-	var err error
 	switch keyType {
-	case ci.Ed25519:
-		pk, _, err = ci.GenerateKeyPair(keyType, 256)
-		if err != nil {
-			return nil, err
-		}
-	case ci.RSA:
-		pk, _, err = ci.GenerateKeyPair(keyType, bits)
-		if err != nil {
-			return nil, err
+	case KeyTypeRSA:
+		if bits < MinRSAKeyBits {
+			return nil, fmt.Errorf("rsa keys must be at least %v bits", MinRSAKeyBits)
 		}
+	case KeyTypeEd25519, KeyTypeSecp256k1, KeyTypeECDSA:
+		// size is determined by the key type
+		bits = 256
 	default:
 		return nil, errors.New("key type provided not a valid key type")
 	}
+	pk, _, err := ci.GenerateKeyPair(keyType, bits)
+	if err != nil {
+		return nil, err
+	}
 	if err = km.SavePrivateKey(keyName, pk); err != nil {
 		return nil, err
 	}
@@ -76,21 +113,32 @@ func (km *KeystoreManager) CreateAndSaveKey(keyName string, keyType, bits int) (
 // ExportKeyAsMnemonic is used to take an IPFS key, and return a human-readable friendly version.
 // The idea is to allow users to easily export the keys they create, allowing them to take control of their records (ipns, tns, etc..)
 func (km *KeystoreManager) ExportKeyAsMnemonic(keyName string) (string, error) {
-	pk, err := km.GetPrivateKeyByName(keyName)
-	if err != nil {
-		return "", err
-	}
-	pkBytes, err := pk.Bytes()
-	if err != nil {
-		return "", err
-	}
-	phrase, err := mnemonics.ToPhrase(pkBytes, mnemonics.English)
-	if err != nil {
+	var phrase mnemonics.Phrase
+	if err := km.exportKey(keyName, func(pkBytes []byte) (err error) {
+		phrase, err = mnemonics.ToPhrase(pkBytes, mnemonics.English)
+		return err
+	}); err != nil {
 		return "", err
 	}
 	return phrase.String(), nil
 }
 
+// exportKey is used to pass the marshaled private key of the named key to export,
+// auditing the whole operation as a single export rather than an access
+func (km *KeystoreManager) exportKey(keyName string, export func(pkBytes []byte) error) error {
+	return km.audited(keyName, AuditExport, func() error {
+		pk, err := km.store.Get(keyName)
+		if err != nil {
+			return err
+		}
+		pkBytes, err := pk.Bytes()
+		if err != nil {
+			return err
+		}
+		return export(pkBytes)
+	})
+}
+
 // MnemonicToKey takes an exported mnemonic phrase, and converts it to a private key
 func MnemonicToKey(phrase string) (ci.PrivKey, error) {
 	mnemonicBytes, err := mnemonics.FromString(phrase, mnemonics.English)
@@ -128,3 +128,45 @@ func TestGetKey(t *testing.T) {
 
 	fmt.Printf("%+v\n", pk2.GetPublic())
 }
+
+func TestCreateAndSaveKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyType int
+		bits    int
+		wantErr bool
+	}{
+		{"RSA", rtfs.KeyTypeRSA, 2048, false},
+		{"RSA-Too-Small", rtfs.KeyTypeRSA, 1024, true},
+		{"Ed25519", rtfs.KeyTypeEd25519, 0, false},
+		{"Secp256k1", rtfs.KeyTypeSecp256k1, 0, false},
+		{"ECDSA", rtfs.KeyTypeECDSA, 0, false},
+		{"Invalid", 100, 0, true},
+		{".Invalid-Name", rtfs.KeyTypeEd25519, 0, true},
+	}
+	kb, err := krab.NewKeystore(dssync.MutexWrap(datastore.NewMapDatastore()), "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	km, err := rtfs.NewKeystoreManager(kb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pk, err := km.CreateAndSaveKey(tt.name, tt.keyType, tt.bits)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateAndSaveKey() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if int(pk.Type()) != tt.keyType {
+				t.Fatal("bad key type generated")
+			}
+			if _, err := km.CreateAndSaveKey(tt.name, tt.keyType, tt.bits); err == nil {
+				t.Fatal("expected error creating duplicate key")
+			}
+		})
+	}
+}
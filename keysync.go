@@ -0,0 +1,161 @@
+package rtfs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// nodeSelfKey is the name of the key an ipfs node uses for its own identity
+const nodeSelfKey = "self"
+
+// KeySync is used to copy keys from a KeystoreManager into the keystore of an
+// ipfs node, so they can be used with IPNS publishing via Manager.Publish
+type KeySync struct {
+	km *KeystoreManager
+	im Manager
+}
+
+// ReconcileResult contains the changes made by KeySync.Reconcile
+type ReconcileResult struct {
+	// Imported contains keys copied to the node
+	Imported []string
+	// Removed contains keys removed from the node as they are not managed by the keystore
+	Removed []string
+	// Mismatched contains keys present in both keystores under the same name, but
+	// with a different identity. These are left untouched
+	Mismatched []string
+}
+
+// NewKeySync is used to instantiate a KeySync
+func NewKeySync(km *KeystoreManager, im Manager) *KeySync {
+	return &KeySync{km: km, im: im}
+}
+
+// Import is used to copy the named key into the ipfs node, reporting whether it
+// was imported. Importing a key that is already present on the node with the same
+// identity is a no-op, and reports false
+func (ks *KeySync) Import(keyName string) (bool, error) {
+	if keyName == nodeSelfKey {
+		return false, errors.New("the node self key can not be imported")
+	}
+	pk, err := ks.km.GetPrivateKeyByName(keyName)
+	if err != nil {
+		return false, err
+	}
+	id, err := peer.IDFromPrivateKey(pk)
+	if err != nil {
+		return false, err
+	}
+	nodeKey, err := ks.nodeKey(keyName)
+	if err != nil {
+		return false, err
+	}
+	if nodeKey != nil {
+		if nodeKey.ID != id.Pretty() {
+			return false, fmt.Errorf("node already has a different key named '%s'", keyName)
+		}
+		return false, nil
+	}
+	if _, err := ks.im.KeyImport(keyName, pk); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Remove is used to remove the named key from the ipfs node
+func (ks *KeySync) Remove(keyName string) error {
+	if keyName == nodeSelfKey {
+		return errors.New("the node self key can not be removed")
+	}
+	return ks.im.KeyRemove(keyName)
+}
+
+// WithKey is used to import the named key into the ipfs node for the duration
+// of fn, removing it from the node afterwards. Keys already present on the node
+// are left in place
+func (ks *KeySync) WithKey(keyName string, fn func() error) error {
+	imported, err := ks.Import(keyName)
+	if err != nil {
+		return err
+	}
+	fnErr := fn()
+	if !imported {
+		return fnErr
+	}
+	if err := ks.Remove(keyName); err != nil && fnErr == nil {
+		return err
+	}
+	return fnErr
+}
+
+// Reconcile is used to import every key in the keystore missing from the ipfs node.
+// When prune is true, keys on the node not present in the keystore are removed
+func (ks *KeySync) Reconcile(prune bool) (*ReconcileResult, error) {
+	names, err := ks.km.ListKeyIdentifiers()
+	if err != nil {
+		return nil, err
+	}
+	nodeKeys, err := ks.im.KeyList()
+	if err != nil {
+		return nil, err
+	}
+	onNode := make(map[string]string, len(nodeKeys))
+	for _, key := range nodeKeys {
+		onNode[key.Name] = key.ID
+	}
+	managed := make(map[string]bool, len(names))
+	result := new(ReconcileResult)
+	for _, name := range names {
+		managed[name] = true
+		if name == nodeSelfKey {
+			continue
+		}
+		pk, err := ks.km.GetPrivateKeyByName(name)
+		if err != nil {
+			return nil, err
+		}
+		id, err := peer.IDFromPrivateKey(pk)
+		if err != nil {
+			return nil, err
+		}
+		nodeID, ok := onNode[name]
+		switch {
+		case !ok:
+			if _, err := ks.im.KeyImport(name, pk); err != nil {
+				return nil, err
+			}
+			result.Imported = append(result.Imported, name)
+		case nodeID != id.Pretty():
+			result.Mismatched = append(result.Mismatched, name)
+		}
+	}
+	if !prune {
+		return result, nil
+	}
+	for _, key := range nodeKeys {
+		if key.Name == nodeSelfKey || managed[key.Name] {
+			continue
+		}
+		if err := ks.im.KeyRemove(key.Name); err != nil {
+			return nil, err
+		}
+		result.Removed = append(result.Removed, key.Name)
+	}
+	return result, nil
+}
+
+// nodeKey returns the named key from the ipfs node, or nil if it is not present
+func (ks *KeySync) nodeKey(keyName string) (*NodeKey, error) {
+	keys, err := ks.im.KeyList()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.Name == keyName {
+			return &key, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,96 @@
+package rtfs_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/RTradeLtd/rtfs/v2"
+	"github.com/RTradeLtd/rtfs/v2/rtfstest"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+// nodeKeys returns the keys held by node, by name
+func nodeKeys(t *testing.T, node rtfs.Manager) map[string]string {
+	t.Helper()
+	keys, err := node.KeyList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]string, len(keys))
+	for _, key := range keys {
+		out[key.Name] = key.ID
+	}
+	return out
+}
+
+func TestKeySync(t *testing.T) {
+	km := newTestKeystoreManager(t)
+	for _, name := range []string{"key1", "key2", "key3"} {
+		if _, err := km.CreateAndSaveKey(name, ci.Ed25519, 256); err != nil {
+			t.Fatal(err)
+		}
+	}
+	node := rtfstest.NewNode()
+	node.SetKey("self", "QmSelf")
+	node.SetKey("key2", "QmNotKey2")
+	node.SetKey("stale", "QmStale")
+	ks := rtfs.NewKeySync(km, node)
+
+	if _, err := ks.Import("key2"); err == nil {
+		t.Fatal("expected error importing over a mismatched key")
+	}
+	if err := ks.WithKey("key1", func() error {
+		if _, ok := nodeKeys(t, node)["key1"]; !ok {
+			t.Fatal("key not imported")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := nodeKeys(t, node)["key1"]; ok {
+		t.Fatal("key not removed")
+	}
+
+	result, err := ks.Reconcile(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(result.Imported)
+	if len(result.Imported) != 2 || result.Imported[0] != "key1" || result.Imported[1] != "key3" {
+		t.Fatalf("bad imported keys %v", result.Imported)
+	}
+	if len(result.Mismatched) != 1 || result.Mismatched[0] != "key2" {
+		t.Fatalf("bad mismatched keys %v", result.Mismatched)
+	}
+	if len(result.Removed) != 0 {
+		t.Fatal("removed keys without pruning")
+	}
+
+	result, err = ks.Reconcile(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Imported) != 0 {
+		t.Fatal("imported keys already on the node")
+	}
+	if len(result.Removed) != 1 || result.Removed[0] != "stale" {
+		t.Fatalf("bad removed keys %v", result.Removed)
+	}
+	if _, ok := nodeKeys(t, node)["self"]; !ok {
+		t.Fatal("self key was removed")
+	}
+
+	// keys already on the node are neither imported nor removed by WithKey
+	if imported, err := ks.Import("key1"); err != nil || imported {
+		t.Fatalf("Import() = %v, %v, want false, nil", imported, err)
+	}
+	if err := ks.WithKey("key1", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := nodeKeys(t, node)["key1"]; !ok {
+		t.Fatal("pre-existing key removed")
+	}
+	if removed := node.Calls("KeyRemove"); len(removed) != 2 || removed[0] != "key1" || removed[1] != "stale" {
+		t.Fatalf("bad removals %v", removed)
+	}
+}
@@ -0,0 +1,222 @@
+package rtfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// MFSEntry is an entry in a mutable file system directory
+type MFSEntry struct {
+	Name string
+	// Type is 0 for files, and 1 for directories
+	Type int
+	Size uint64
+	Hash string
+}
+
+// MFSStat is information about a mutable file system file or directory
+type MFSStat struct {
+	Hash           string
+	Size           uint64
+	CumulativeSize uint64
+	Blocks         int
+	// Type is either "file" or "directory"
+	Type string
+}
+
+// MFSWriteOpts is used to control how a mutable file system file is written
+type MFSWriteOpts struct {
+	// Offset is the byte offset to begin writing at
+	Offset int64
+	// Create creates the file if it does not exist
+	Create bool
+	// Parents creates any missing parent directories
+	Parents bool
+	// Truncate truncates the file to zero bytes before writing
+	Truncate bool
+}
+
+// WithMFSRoot is used to scope mutable file system operations to root, creating it if
+// needed. All paths given to the returned manager are relative to root, and can not
+// escape it, so that each tenant can be given their own tree. Other operations are
+// unaffected. Roots nest, so scoping an already scoped manager narrows it further
+func (im *IpfsManager) WithMFSRoot(root string) (Manager, error) {
+	scopedRoot, err := im.mfsPath(root)
+	if err != nil {
+		return nil, err
+	}
+	if scopedRoot != "/" {
+		if err := im.shell.Request("files/mkdir", scopedRoot).
+			Option("parents", true).
+			Exec(context.Background(), nil); err != nil {
+			return nil, err
+		}
+	}
+	scoped := *im
+	scoped.mfsRoot = scopedRoot
+	return &scoped, nil
+}
+
+// FilesMkdir is used to create a mutable file system directory
+func (im *IpfsManager) FilesMkdir(dir string, parents bool) error {
+	p, err := im.mfsPath(dir)
+	if err != nil {
+		return err
+	}
+	return im.shell.Request("files/mkdir", p).Option("parents", parents).Exec(context.Background(), nil)
+}
+
+// FilesWrite is used to write the contents of r to a mutable file system file
+func (im *IpfsManager) FilesWrite(file string, r io.Reader, opts MFSWriteOpts) error {
+	p, err := im.mfsPath(file)
+	if err != nil {
+		return err
+	}
+	if opts.Offset < 0 {
+		return errors.New("offset must not be negative")
+	}
+	body := singleFileReaderBody(r)
+	return im.shell.Request("files/write", p).
+		Option("offset", opts.Offset).
+		Option("create", opts.Create).
+		Option("parents", opts.Parents).
+		Option("truncate", opts.Truncate).
+		Body(body).
+		Exec(context.Background(), nil)
+}
+
+// FilesRead is used to read a mutable file system file, starting at offset.
+// If count is greater than zero, at most count bytes are read
+func (im *IpfsManager) FilesRead(file string, offset, count int64) ([]byte, error) {
+	p, err := im.mfsPath(file)
+	if err != nil {
+		return nil, err
+	}
+	req := im.shell.Request("files/read", p).Option("offset", offset)
+	if count > 0 {
+		req = req.Option("count", count)
+	}
+	resp, err := req.Send(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return ioutil.ReadAll(resp.Output)
+}
+
+// FilesLs is used to list a mutable file system directory
+func (im *IpfsManager) FilesLs(dir string) ([]MFSEntry, error) {
+	p, err := im.mfsPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out struct{ Entries []MFSEntry }
+	if err := im.shell.Request("files/ls", p).Option("l", true).Exec(context.Background(), &out); err != nil {
+		return nil, err
+	}
+	return out.Entries, nil
+}
+
+// FilesStat is used to retrieve information about a mutable file system file or directory
+func (im *IpfsManager) FilesStat(file string) (*MFSStat, error) {
+	p, err := im.mfsPath(file)
+	if err != nil {
+		return nil, err
+	}
+	var out MFSStat
+	if err := im.shell.Request("files/stat", p).Exec(context.Background(), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// FilesMv is used to move a mutable file system file or directory
+func (im *IpfsManager) FilesMv(src, dst string) error {
+	srcPath, err := im.mfsPath(src)
+	if err != nil {
+		return err
+	}
+	dstPath, err := im.mfsPath(dst)
+	if err != nil {
+		return err
+	}
+	if srcPath == im.scopedRoot() {
+		return errors.New("can not move the mutable file system root")
+	}
+	return im.shell.Request("files/mv", srcPath, dstPath).Exec(context.Background(), nil)
+}
+
+// FilesCp is used to copy a file or directory into the mutable file system. src
+// may be a mutable file system path, or an /ipfs/ path to copy existing content
+func (im *IpfsManager) FilesCp(src, dst string) error {
+	var (
+		srcPath string
+		err     error
+	)
+	if strings.HasPrefix(src, "/ipfs/") {
+		srcPath, err = NormalizeIPFSPath(src)
+	} else {
+		srcPath, err = im.mfsPath(src)
+	}
+	if err != nil {
+		return err
+	}
+	dstPath, err := im.mfsPath(dst)
+	if err != nil {
+		return err
+	}
+	return im.shell.Request("files/cp", srcPath, dstPath).Exec(context.Background(), nil)
+}
+
+// FilesRm is used to remove a mutable file system file, or directory if recursive is set
+func (im *IpfsManager) FilesRm(file string, recursive bool) error {
+	p, err := im.mfsPath(file)
+	if err != nil {
+		return err
+	}
+	if p == im.scopedRoot() {
+		return errors.New("can not remove the mutable file system root")
+	}
+	return im.shell.Request("files/rm", p).Option("recursive", recursive).Exec(context.Background(), nil)
+}
+
+// FilesFlush is used to flush a mutable file system path to disk, returning its hash
+func (im *IpfsManager) FilesFlush(file string) (string, error) {
+	p, err := im.mfsPath(file)
+	if err != nil {
+		return "", err
+	}
+	var out struct{ Cid string }
+	if err := im.shell.Request("files/flush", p).Exec(context.Background(), &out); err != nil {
+		return "", err
+	}
+	return out.Cid, nil
+}
+
+// scopedRoot returns the mutable file system root operations are scoped to
+func (im *IpfsManager) scopedRoot() string {
+	if im.mfsRoot == "" {
+		return "/"
+	}
+	return im.mfsRoot
+}
+
+// mfsPath resolves a path relative to the mutable file system root. The
+// path is cleaned as if it were absolute, so it can not escape the root
+func (im *IpfsManager) mfsPath(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("path is empty")
+	}
+	if strings.HasPrefix(p, "/ipfs/") || strings.HasPrefix(p, "/ipns/") {
+		return "", fmt.Errorf("'%s' is not a mutable file system path", p)
+	}
+	return path.Join(im.scopedRoot(), path.Clean("/"+p)), nil
+}
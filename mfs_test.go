@@ -0,0 +1,147 @@
+package rtfs_test
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/rtfs/v2"
+)
+
+func TestMFS_TenantIsolation(t *testing.T) {
+	var calls []string
+	record := func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, strings.TrimPrefix(r.URL.Path, "/api/v0/")+" "+strings.Join(r.URL.Query()["arg"], " "))
+	}
+	im := newFakeNode(t, map[string]http.HandlerFunc{
+		"files/mkdir": record,
+		"files/rm":    record,
+		"files/mv":    record,
+		"files/cp":    record,
+		"files/read": func(w http.ResponseWriter, r *http.Request) {
+			record(w, r)
+			w.Write([]byte("hello"))
+		},
+		"files/write": func(w http.ResponseWriter, r *http.Request) {
+			record(w, r)
+			if r.URL.Query().Get("offset") != "5" || r.URL.Query().Get("truncate") != "true" {
+				t.Error("bad write options")
+			}
+		},
+	})
+	tenant, err := im.WithMFSRoot("/tenants/alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested, err := tenant.WithMFSRoot("projects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		call    func() error
+		want    string
+		wantErr bool
+	}{
+		{"Mkdir", func() error { return tenant.FilesMkdir("/docs", true) }, "files/mkdir /tenants/alice/docs", false},
+		{"Relative", func() error { return tenant.FilesMkdir("docs/a", true) }, "files/mkdir /tenants/alice/docs/a", false},
+		{"Escape", func() error { return tenant.FilesMkdir("/../../bob", true) }, "files/mkdir /tenants/alice/bob", false},
+		{"Nested", func() error { return nested.FilesMkdir("/x", false) }, "files/mkdir /tenants/alice/projects/x", false},
+		{"Unscoped", func() error { return im.FilesMkdir("/x", false) }, "files/mkdir /x", false},
+		{"Write", func() error {
+			return tenant.FilesWrite("/a.txt", bytes.NewReader([]byte("world")), rtfs.MFSWriteOpts{Offset: 5, Truncate: true})
+		}, "files/write /tenants/alice/a.txt", false},
+		{"Read", func() error {
+			data, err := tenant.FilesRead("/a.txt", 0, 0)
+			if err == nil && string(data) != "hello" {
+				t.Fatal("bad data read")
+			}
+			return err
+		}, "files/read /tenants/alice/a.txt", false},
+		{"Mv", func() error { return tenant.FilesMv("/a.txt", "/b.txt") }, "files/mv /tenants/alice/a.txt /tenants/alice/b.txt", false},
+		{"Cp-IPFS", func() error { return tenant.FilesCp("/ipfs/"+testPIN, "/pin") }, "files/cp /ipfs/" + testPIN + " /tenants/alice/pin", false},
+		{"Cp-MFS", func() error { return tenant.FilesCp("/b.txt", "/c.txt") }, "files/cp /tenants/alice/b.txt /tenants/alice/c.txt", false},
+		{"Rm", func() error { return tenant.FilesRm("/docs", true) }, "files/rm /tenants/alice/docs", false},
+		{"Rm-Root", func() error { return tenant.FilesRm("/", true) }, "", true},
+		{"Rm-Escaped-Root", func() error { return tenant.FilesRm("/..", true) }, "", true},
+		{"Mv-Root", func() error { return nested.FilesMv("/", "/moved") }, "", true},
+		{"Cp-Invalid-CID", func() error { return tenant.FilesCp("/ipfs/notacid", "/pin") }, "", true},
+		{"IPFS-Destination", func() error { return tenant.FilesMkdir("/ipfs/"+testPIN, false) }, "", true},
+		{"Empty", func() error { return tenant.FilesMkdir("", false) }, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			if err := tt.call(); (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(calls) != 0 {
+					t.Fatalf("unexpected call %v", calls)
+				}
+				return
+			}
+			if len(calls) != 1 || calls[0] != tt.want {
+				t.Fatalf("calls = %v, want %v", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestMFS(t *testing.T) {
+	im, err := rtfs.NewManager(nodeOneAPIAddr, "", time.Minute*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenant, err := im.WithMFSRoot("/rtfs-test/" + time.Now().Format("20060102150405.000000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tenant.FilesMkdir("/docs/nested", true); err != nil {
+		t.Fatal(err)
+	}
+	opts := rtfs.MFSWriteOpts{Create: true}
+	if err := tenant.FilesWrite("/docs/hello.txt", strings.NewReader("hello world"), opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenant.FilesWrite("/docs/hello.txt", strings.NewReader("there"), rtfs.MFSWriteOpts{Offset: 6}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := tenant.FilesRead("/docs/hello.txt", 6, 3); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "the" {
+		t.Fatalf("FilesRead() = %s, want the", data)
+	}
+	if err := tenant.FilesMv("/docs/hello.txt", "/docs/nested/hello.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenant.FilesCp("/ipfs/"+testPIN, "/docs/pin"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := tenant.FilesLs("/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("FilesLs() returned %v entries, want 2", len(entries))
+	}
+	stat, err := tenant.FilesStat("/docs/nested/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	} else if stat.Type != "file" || stat.Size != 11 {
+		t.Fatalf("bad stat %+v", stat)
+	}
+	if hash, err := tenant.FilesFlush("/"); err != nil {
+		t.Fatal(err)
+	} else if hash == "" {
+		t.Fatal("no hash returned from flush")
+	}
+	if err := tenant.FilesRm("/docs", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := im.FilesStat("/rtfs-test"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,50 @@
+package rtfs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// patch operation types
+const (
+	// PatchOpAddLink links Hash into the object under Name, creating
+	// intermediate objects for nested names if Create is set
+	PatchOpAddLink = "add-link"
+	// PatchOpRmLink removes the link called Name
+	PatchOpRmLink = "rm-link"
+	// PatchOpSetData replaces the data of the object with Data
+	PatchOpSetData = "set-data"
+	// PatchOpAppendData appends Data to the data of the object
+	PatchOpAppendData = "append-data"
+)
+
+// PatchOp is a single operation applied by Patch
+type PatchOp struct {
+	Type   string
+	Name   string
+	Hash   string
+	Create bool
+	Data   []byte
+}
+
+// validate checks that the operation can be applied, so that a malformed
+// operation is rejected before any operation is sent to the node
+func (op PatchOp) validate() error {
+	switch op.Type {
+	case PatchOpAddLink:
+		if op.Name == "" {
+			return errors.New("link name is empty")
+		}
+		_, err := cidArg(op.Hash)
+		return err
+	case PatchOpRmLink:
+		if op.Name == "" {
+			return errors.New("link name is empty")
+		}
+		return nil
+	case PatchOpSetData, PatchOpAppendData:
+		return nil
+	default:
+		return fmt.Errorf("unknown patch operation '%s'", op.Type)
+	}
+}
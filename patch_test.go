@@ -0,0 +1,114 @@
+package rtfs_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/rtfs/v2"
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// fakeCID returns a valid cid derived from name, for fake nodes to return
+func fakeCID(name string) string {
+	hash, _ := mh.Sum([]byte(name), mh.SHA2_256, -1)
+	return cid.NewCidV0(hash).String()
+}
+
+func TestPatch_Sequence(t *testing.T) {
+	var calls []string
+	patch := func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, strings.TrimPrefix(r.URL.Path, "/api/v0/object/patch/")+" "+strings.Join(r.URL.Query()["arg"], " "))
+		if r.URL.Query().Get("arg") == fakeCID("broken") {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"Message":"patch failed","Code":0,"Type":"error"}`))
+			return
+		}
+		fmt.Fprintf(w, `{"Hash":"%s"}`, fakeCID(fmt.Sprintf("hash-%d", len(calls))))
+	}
+	im := newFakeNode(t, map[string]http.HandlerFunc{
+		"object/patch/add-link":    patch,
+		"object/patch/rm-link":     patch,
+		"object/patch/set-data":    patch,
+		"object/patch/append-data": patch,
+	})
+	ops := []rtfs.PatchOp{
+		{Type: rtfs.PatchOpAddLink, Name: "a/b", Hash: testPIN, Create: true},
+		{Type: rtfs.PatchOpRmLink, Name: "old"},
+		{Type: rtfs.PatchOpSetData, Data: []byte("hello")},
+		{Type: rtfs.PatchOpAppendData, Data: []byte("world")},
+	}
+	root := fakeCID("root")
+	hashes, err := im.Patch(root, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"add-link " + root + " a/b " + testPIN,
+		"rm-link " + fakeCID("hash-1") + " old",
+		"set-data " + fakeCID("hash-2"),
+		"append-data " + fakeCID("hash-3"),
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("call %v = %v, want %v", i, calls[i], want[i])
+		}
+	}
+	if len(hashes) != 4 || hashes[3] != fakeCID("hash-4") {
+		t.Fatalf("Patch() = %v", hashes)
+	}
+
+	calls = nil
+	if hashes, err = im.Patch(fakeCID("broken"), ops); err == nil || len(hashes) != 0 {
+		t.Fatalf("Patch() = %v, err = %v, want an error", hashes, err)
+	}
+	// malformed hashes are rejected before anything is sent to the node
+	calls = nil
+	for _, root := range []string{"root", ""} {
+		if _, err = im.Patch(root, ops); err == nil {
+			t.Fatalf("Patch(%q) err = nil, want an error", root)
+		}
+	}
+	// as are malformed operations, so a patch is never left half applied
+	for name, op := range map[string]rtfs.PatchOp{
+		"Invalid-Hash":     {Type: rtfs.PatchOpAddLink, Name: "a", Hash: "not-a-cid"},
+		"Add-Without-Name": {Type: rtfs.PatchOpAddLink, Hash: testPIN},
+		"Rm-Without-Name":  {Type: rtfs.PatchOpRmLink},
+		"Unknown-Type":     {Type: "move-link"},
+	} {
+		hashes, err := im.Patch(fakeCID("root"), []rtfs.PatchOp{{Type: rtfs.PatchOpRmLink, Name: "old"}, op})
+		if err == nil || len(hashes) != 0 {
+			t.Fatalf("%s: Patch() = %v, err = %v, want an error", name, hashes, err)
+		}
+	}
+	if len(calls) != 0 {
+		t.Fatalf("calls = %v, want none", calls)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	im, err := rtfs.NewManager(nodeOneAPIAddr, "", time.Minute*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes, err := im.Patch(testDefaultReadme, []rtfs.PatchOp{
+		{Type: rtfs.PatchOpAddLink, Name: "testPatchLink", Hash: testPIN},
+		{Type: rtfs.PatchOpRmLink, Name: "testPatchLink"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// matches the object produced by TestPatchLink, then reverts to the original
+	if len(hashes) != 2 || hashes[0] != "QmT2d72bKhhzXSQ5TJ72mPdc3sTQmdrwuPqqLfybL6uUVc" || hashes[1] != testDefaultReadme {
+		t.Fatalf("Patch() = %v", hashes)
+	}
+	if _, err := im.PatchRmLink(testDefaultReadme, "missing-link"); err == nil {
+		t.Fatal("expected error removing missing link")
+	}
+}
@@ -0,0 +1,202 @@
+package rtfs_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/rtfs/v2"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// newFakeNode starts an http server answering the ipfs api calls in handlers,
+// and returns a manager connected to it
+func newFakeNode(t *testing.T, handlers map[string]http.HandlerFunc) *rtfs.IpfsManager {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v0/id", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ID":"fake"}`))
+	})
+	for path, handler := range handlers {
+		mux.HandleFunc("/api/v0/"+path, handler)
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	im, err := rtfs.NewManager(strings.TrimPrefix(srv.URL, "http://"), "", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return im
+}
+
+func TestPubSubSubscribe_Resubscribe(t *testing.T) {
+	pk, _, err := ci.GenerateKeyPair(ci.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := peer.IDFromPrivateKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var subscriptions int32
+	im := newFakeNode(t, map[string]http.HandlerFunc{
+		"pubsub/sub": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("arg") != "topic" {
+				t.Error("bad topic subscribed to")
+			}
+			count := atomic.AddInt32(&subscriptions, 1)
+			// each subscription delivers a single message before dropping the connection
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"from":     []byte(sender),
+				"data":     []byte("hello"),
+				"seqno":    []byte{0, 0, 0, 0, 0, 0, 1, byte(count)},
+				"topicIDs": []string{"topic"},
+			})
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := im.PubSubSubscribe(ctx, ""); err == nil {
+		t.Fatal("expected error subscribing to empty topic")
+	}
+	messages, err := im.PubSubSubscribe(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		select {
+		case msg := <-messages:
+			if msg.From != sender || string(msg.Data) != "hello" || msg.Topic != "topic" || msg.Seqno != uint64(256+i) {
+				t.Fatalf("bad message received %+v", msg)
+			}
+		case <-time.After(time.Second * 10):
+			t.Fatal("timed out waiting for message")
+		}
+	}
+	if atomic.LoadInt32(&subscriptions) < 2 {
+		t.Fatal("failed to resubscribe")
+	}
+	cancel()
+	for range messages {
+	}
+}
+
+func TestPubSubSubscribe(t *testing.T) {
+	im, err := rtfs.NewManager(nodeOneAPIAddr, "", time.Minute*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	messages, err := im.PubSubSubscribe(ctx, "rtfs-subscribe-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := im.PubSubPublish("rtfs-subscribe-test", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	msg, ok := <-messages
+	if !ok {
+		t.Fatal("subscription closed before receiving message")
+	}
+	if string(msg.Data) != "hello" {
+		t.Fatal("bad message received")
+	}
+}
+
+func TestPubSubPublishBytes(t *testing.T) {
+	im, err := rtfs.NewManager(nodeOneAPIAddr, "", time.Minute*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	messages, err := im.PubSubSubscribe(ctx, "rtfs-publish-bytes-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each payload must arrive as a single message, as it was sent
+	payloads := [][]byte{
+		{0, 1, '\n', 2, '\n', 0xff},
+		{},
+		[]byte("last\n"),
+	}
+	for _, payload := range payloads {
+		if err := im.PubSubPublishBytes("rtfs-publish-bytes-test", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range payloads {
+		msg, ok := <-messages
+		if !ok {
+			t.Fatal("subscription closed before receiving every message")
+		}
+		if !bytes.Equal(msg.Data, want) {
+			t.Fatalf("received %q, want %q", msg.Data, want)
+		}
+	}
+}
+
+func TestPubSubTopicsAndPeers(t *testing.T) {
+	pk, _, err := ci.GenerateKeyPair(ci.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscriber, err := peer.IDFromPrivateKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	im := newFakeNode(t, map[string]http.HandlerFunc{
+		"pubsub/ls": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string][]string{"Strings": {"busy", "quiet"}})
+		},
+		"pubsub/peers": func(w http.ResponseWriter, r *http.Request) {
+			var peers []string
+			if topic := r.URL.Query().Get("arg"); topic == "" || topic == "busy" {
+				peers = append(peers, subscriber.Pretty())
+			}
+			json.NewEncoder(w).Encode(map[string][]string{"Strings": peers})
+		},
+	})
+	topics, err := im.PubSubTopics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != 2 || topics[0] != "busy" || topics[1] != "quiet" {
+		t.Fatal("bad topics listed")
+	}
+	peers, err := im.PubSubPeers("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0] != subscriber {
+		t.Fatal("bad peers listed")
+	}
+	tests := []struct {
+		name    string
+		topic   string
+		want    bool
+		wantErr bool
+	}{
+		{"Busy", "busy", true, false},
+		{"Quiet", "quiet", false, false},
+		{"Empty", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rtfs.TopicHasPeers(tt.topic, im)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TopicHasPeers() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("TopicHasPeers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package rtfs_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/rtfs/v2"
+)
+
+func TestRefsStream_Options(t *testing.T) {
+	var query map[string][]string
+	im := newFakeNode(t, map[string]http.HandlerFunc{
+		"refs": func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			for i := 0; i < 5; i++ {
+				fmt.Fprintf(w, `{"Ref":"ref-%d","Err":""}`+"\n", i)
+			}
+			w.Write([]byte(`{"Ref":"","Err":"merkledag: not found"}` + "\n"))
+		},
+	})
+	tests := []struct {
+		name    string
+		opts    rtfs.RefsOpts
+		want    map[string]string
+		wantErr bool
+	}{
+		{"Default", rtfs.RefsOpts{}, map[string]string{"recursive": "false", "unique": "false", "edges": "false"}, false},
+		{"Edges", rtfs.RefsOpts{Recursive: true, Edges: true}, map[string]string{"recursive": "true", "edges": "true"}, false},
+		{"Max-Depth", rtfs.RefsOpts{MaxDepth: 2, Unique: true}, map[string]string{"recursive": "true", "unique": "true", "max-depth": "2"}, false},
+		{"Format", rtfs.RefsOpts{Format: "<src> <linkname>"}, map[string]string{"format": "<src> <linkname>"}, false},
+		{"Edges-And-Format", rtfs.RefsOpts{Edges: true, Format: "<dst>"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refs, err := im.RefsStream(context.Background(), testPIN, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RefsStream() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got []rtfs.RefResult
+			for ref := range refs {
+				got = append(got, ref)
+			}
+			if len(got) != 6 {
+				t.Fatalf("RefsStream() returned %v refs, want 6", len(got))
+			}
+			// refs are received in the order the node sent them
+			for i, ref := range got[:5] {
+				if ref.Ref != fmt.Sprintf("ref-%d", i) || ref.Err != nil {
+					t.Fatalf("ref %v = %+v", i, ref)
+				}
+			}
+			if got[5].Err == nil || got[5].Err.Error() != "merkledag: not found" {
+				t.Fatalf("RefsStream() err = %v, want node error", got[5].Err)
+			}
+			for option, value := range tt.want {
+				if len(query[option]) == 0 || query[option][0] != value {
+					t.Fatalf("option %s = %v, want %v", option, query[option], value)
+				}
+			}
+		})
+	}
+}
+
+func TestRefsStream_Cancel(t *testing.T) {
+	im := newFakeNode(t, map[string]http.HandlerFunc{
+		"refs": func(w http.ResponseWriter, r *http.Request) {
+			for {
+				if _, err := w.Write([]byte(`{"Ref":"ref","Err":""}` + "\n")); err != nil {
+					return
+				}
+				w.(http.Flusher).Flush()
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(time.Millisecond):
+				}
+			}
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	refs, err := im.RefsStream(ctx, testPIN, rtfs.RefsOpts{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-refs
+	cancel()
+	for range refs {
+	}
+}
+
+func TestRefsStream(t *testing.T) {
+	im, err := rtfs.NewManager(nodeOneAPIAddr, "", time.Minute*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, err := im.RefsStream(context.Background(), testRefsHash, rtfs.RefsOpts{Recursive: true, Edges: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	for ref := range refs {
+		if ref.Err != nil {
+			t.Fatal(ref.Err)
+		}
+		count++
+	}
+	if count == 0 {
+		t.Fatal("no refs received")
+	}
+}
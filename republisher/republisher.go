@@ -0,0 +1,298 @@
+package republisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/rtfs/v2"
+	datastore "github.com/ipfs/go-datastore"
+	namespace "github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// Entry is an IPNS name managed by the republisher
+type Entry struct {
+	// KeyName is the name of the key the record is published with
+	KeyName string `json:"key_name"`
+	// Value is the path the record points to
+	Value string `json:"value"`
+	// Lifetime is how long each published record is valid for
+	Lifetime time.Duration `json:"lifetime"`
+	// TTL is the cache hint of each published record
+	TTL time.Duration `json:"ttl"`
+}
+
+// Status is the publishing state of an entry
+type Status struct {
+	Entry
+	LastPublished time.Time `json:"last_published"`
+	NextPublish   time.Time `json:"next_publish"`
+	// Failures is the number of consecutive failed publishes
+	Failures  int    `json:"failures"`
+	LastError string `json:"last_error"`
+}
+
+// PublishFunc is used to publish an entry
+type PublishFunc func(entry Entry) error
+
+// NodePublisher returns a PublishFunc which publishes using a key held by the ipfs node
+func NodePublisher(im rtfs.Manager) PublishFunc {
+	return func(entry Entry) error {
+		_, err := im.Publish(entry.Value, entry.KeyName, entry.Lifetime, entry.TTL, false)
+		return err
+	}
+}
+
+// RecordPublisher returns a PublishFunc which signs records locally using a key
+// from the keystore manager, see rtfs.PublishIPNSRecord
+func RecordPublisher(im rtfs.Manager, km *rtfs.KeystoreManager) PublishFunc {
+	return func(entry Entry) error {
+		_, err := rtfs.PublishIPNSRecord(im, km, entry.KeyName, entry.Value, entry.Lifetime, entry.TTL)
+		return err
+	}
+}
+
+// Options is used to configure the republisher
+type Options struct {
+	// Interval is how often to check for entries that are due, defaults to one minute
+	Interval time.Duration
+	// Jitter is the fraction of the republish period to randomly offset each
+	// publish by, so that entries tracked together are not republished together.
+	// It must be at least 0 and less than 1, and defaults to 0.1 when zero
+	Jitter float64
+	// DisableJitter publishes each entry exactly halfway through its lifetime
+	DisableJitter bool
+	// RetryBackoff is how long to wait before retrying a failed publish, doubling
+	// with each consecutive failure. Defaults to one minute
+	RetryBackoff time.Duration
+	// MaxRetryBackoff caps the retry backoff, defaults to one hour
+	MaxRetryBackoff time.Duration
+}
+
+// Republisher is used to republish IPNS records before they expire. Entries are
+// republished halfway through their lifetime, and persisted to a datastore so
+// republishing survives restarts
+type Republisher struct {
+	ds      datastore.Batching
+	publish PublishFunc
+	opts    Options
+	// mux guards the datastore, and is not held while publishing
+	mux sync.Mutex
+	// runMux ensures only one round of publishing happens at a time
+	runMux sync.Mutex
+}
+
+// New is used to instantiate our republisher
+func New(ds datastore.Batching, publish PublishFunc, opts Options) (*Republisher, error) {
+	if opts.Jitter < 0 || opts.Jitter >= 1 {
+		return nil, errors.New("jitter must be at least 0 and less than 1")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.DisableJitter {
+		opts.Jitter = 0
+	} else if opts.Jitter == 0 {
+		opts.Jitter = 0.1
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = time.Minute
+	}
+	if opts.MaxRetryBackoff <= 0 {
+		opts.MaxRetryBackoff = time.Hour
+	}
+	return &Republisher{
+		ds:      namespace.Wrap(ds, datastore.NewKey("/rtfsrepublisher")),
+		publish: publish,
+		opts:    opts,
+	}, nil
+}
+
+// Track is used to start managing an entry, replacing any existing entry
+// for the same key. The entry is published on the next check
+func (r *Republisher) Track(entry Entry) error {
+	if entry.KeyName == "" || entry.Value == "" {
+		return errors.New("key name and value must be provided")
+	} else if entry.Lifetime <= 0 {
+		return errors.New("lifetime must be greater than zero")
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	status := &Status{Entry: entry}
+	if existing, err := r.get(entry.KeyName); err == nil {
+		status.LastPublished = existing.LastPublished
+	} else if err != datastore.ErrNotFound {
+		return err
+	}
+	return r.put(status)
+}
+
+// Untrack is used to stop managing the entry for the named key
+func (r *Republisher) Untrack(keyName string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.ds.Delete(datastore.NewKey(keyName))
+}
+
+// Status returns the publishing state of the entry for the named key
+func (r *Republisher) Status(keyName string) (*Status, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.get(keyName)
+}
+
+// List returns the publishing state of all entries, ordered by key name
+func (r *Republisher) List() ([]Status, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.list()
+}
+
+// Run is used to republish entries as they become due, until the context is cancelled
+func (r *Republisher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+	for {
+		// failures are recorded against each entry
+		_ = r.RepublishDue()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RepublishDue is used to publish every entry that is due. Failures are recorded
+// in the entry status, and the last failure is returned. Entries are published
+// without holding the lock, so they can be tracked and inspected meanwhile
+func (r *Republisher) RepublishDue() error {
+	r.runMux.Lock()
+	defer r.runMux.Unlock()
+	due, err := r.due(time.Now())
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, status := range due {
+		err := r.publish(status.Entry)
+		if err != nil {
+			lastErr = err
+		}
+		if err := r.recordPublish(status, err); err != nil {
+			return err
+		}
+	}
+	return lastErr
+}
+
+// due returns the status of every entry due to be published at now
+func (r *Republisher) due(now time.Time) ([]Status, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	statuses, err := r.list()
+	if err != nil {
+		return nil, err
+	}
+	due := statuses[:0]
+	for _, status := range statuses {
+		if !status.NextPublish.After(now) {
+			due = append(due, status)
+		}
+	}
+	return due, nil
+}
+
+// recordPublish is used to update the status of a published entry. Entries
+// untracked or replaced while being published are left as they are
+func (r *Republisher) recordPublish(published Status, publishErr error) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	status, err := r.get(published.KeyName)
+	if err == datastore.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if status.Entry != published.Entry {
+		return nil
+	}
+	now := time.Now()
+	if publishErr != nil {
+		status.Failures++
+		status.LastError = publishErr.Error()
+		status.NextPublish = now.Add(r.retryBackoff(status.Failures))
+	} else {
+		status.Failures = 0
+		status.LastError = ""
+		status.LastPublished = now
+		status.NextPublish = now.Add(r.republishPeriod(status.Lifetime))
+	}
+	return r.put(status)
+}
+
+// republishPeriod returns half the lifetime, randomly offset by the configured jitter
+func (r *Republisher) republishPeriod(lifetime time.Duration) time.Duration {
+	period := lifetime / 2
+	jitter := time.Duration(float64(period) * r.opts.Jitter * (2*rand.Float64() - 1))
+	return period + jitter
+}
+
+func (r *Republisher) retryBackoff(failures int) time.Duration {
+	backoff := r.opts.RetryBackoff
+	for i := 1; i < failures && backoff < r.opts.MaxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > r.opts.MaxRetryBackoff {
+		return r.opts.MaxRetryBackoff
+	}
+	return backoff
+}
+
+func (r *Republisher) get(keyName string) (*Status, error) {
+	data, err := r.ds.Get(datastore.NewKey(keyName))
+	if err != nil {
+		return nil, err
+	}
+	status := new(Status)
+	if err := json.Unmarshal(data, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (r *Republisher) put(status *Status) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return r.ds.Put(datastore.NewKey(status.KeyName), data)
+}
+
+func (r *Republisher) list() ([]Status, error) {
+	results, err := r.ds.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(entries))
+	for _, entry := range entries {
+		var status Status
+		if err := json.Unmarshal(entry.Value, &status); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].KeyName < statuses[j].KeyName
+	})
+	return statuses, nil
+}
@@ -0,0 +1,182 @@
+package republisher_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/rtfs/v2/republisher"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+func TestRepublisher(t *testing.T) {
+	var (
+		published []republisher.Entry
+		failing   = map[string]bool{"broken": true}
+	)
+	publish := func(entry republisher.Entry) error {
+		if failing[entry.KeyName] {
+			return errors.New("publish failed")
+		}
+		published = append(published, entry)
+		return nil
+	}
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	rp, err := republisher.New(ds, publish, republisher.Options{Jitter: 0.2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.Track(republisher.Entry{KeyName: "invalid"}); err == nil {
+		t.Fatal("expected error tracking invalid entry")
+	}
+	for _, name := range []string{"working", "broken"} {
+		if err := rp.Track(republisher.Entry{KeyName: name, Value: "/ipfs/hello", Lifetime: time.Hour, TTL: time.Minute}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rp.RepublishDue(); err == nil {
+		t.Fatal("expected error from failing entry")
+	}
+	if len(published) != 1 || published[0].KeyName != "working" {
+		t.Fatal("bad entries published")
+	}
+	// nothing should be due yet
+	if err := rp.RepublishDue(); err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 1 {
+		t.Fatal("entry republished before it was due")
+	}
+
+	status, err := rp.Status("working")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.LastPublished.IsZero() || status.Failures != 0 {
+		t.Fatal("bad status for working entry")
+	}
+	// half the lifetime with 20% jitter
+	if next := time.Until(status.NextPublish); next < 23*time.Minute || next > 37*time.Minute {
+		t.Fatalf("bad next publish %v", next)
+	}
+	status, err = rp.Status("broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.LastPublished.IsZero() || status.Failures != 1 || status.LastError != "publish failed" {
+		t.Fatal("bad status for broken entry")
+	}
+
+	// state persists across instances
+	if rp, err = republisher.New(ds, publish, republisher.Options{Interval: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	failing["broken"] = false
+	statuses, err := rp.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].KeyName != "broken" {
+		t.Fatal("bad statuses listed")
+	}
+	if err := rp.Untrack("working"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.Status("working"); err == nil {
+		t.Fatal("expected error for untracked entry")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := rp.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	// the broken entry is retried after its backoff, so is not yet published
+	if len(published) != 1 {
+		t.Fatal("entry retried before backoff elapsed")
+	}
+}
+
+func TestRepublisher_PublishWithoutLock(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	var rp *republisher.Republisher
+	publish := func(entry republisher.Entry) error {
+		// the republisher can be used while publishing
+		if _, err := rp.Status(entry.KeyName); err != nil {
+			return err
+		}
+		if entry.KeyName == "replaced" {
+			entry.Value = "/ipfs/world"
+			return rp.Track(entry)
+		}
+		return nil
+	}
+	var err error
+	if rp, err = republisher.New(ds, publish, republisher.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"kept", "replaced"} {
+		if err := rp.Track(republisher.Entry{KeyName: name, Value: "/ipfs/hello", Lifetime: time.Hour}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rp.RepublishDue(); err != nil {
+		t.Fatal(err)
+	}
+	status, err := rp.Status("kept")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.LastPublished.IsZero() {
+		t.Fatal("published entry not recorded")
+	}
+	// an entry replaced while publishing stays due, so its new value is published
+	status, err = rp.Status("replaced")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Value != "/ipfs/world" || !status.LastPublished.IsZero() || !status.NextPublish.IsZero() {
+		t.Fatalf("bad status for replaced entry %+v", status)
+	}
+}
+
+func TestNew_Jitter(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	publish := func(entry republisher.Entry) error { return nil }
+	tests := []struct {
+		name    string
+		opts    republisher.Options
+		wantErr bool
+	}{
+		{"Default", republisher.Options{}, false},
+		{"Disabled", republisher.Options{DisableJitter: true}, false},
+		{"Negative", republisher.Options{Jitter: -0.1}, true},
+		{"Whole-Period", republisher.Options{Jitter: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := republisher.New(ds, publish, tt.opts); (err != nil) != tt.wantErr {
+				t.Fatalf("New() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	rp, err := republisher.New(ds, publish, republisher.Options{DisableJitter: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.Track(republisher.Entry{KeyName: "exact", Value: "/ipfs/hello", Lifetime: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+	if err := rp.RepublishDue(); err != nil {
+		t.Fatal(err)
+	}
+	status, err := rp.Status("exact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := status.NextPublish.Sub(before); next < 30*time.Minute || next > 30*time.Minute+time.Second {
+		t.Fatalf("bad next publish %v", next)
+	}
+}
@@ -0,0 +1,220 @@
+package rtfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// DefaultResolveCacheTTL is the longest a resolved name is cached by default
+const DefaultResolveCacheTTL = time.Minute
+
+// hop sources
+const (
+	// HopIPNS is a hop resolved from a validated IPNS record
+	HopIPNS = "ipns"
+	// HopDNSLink is a hop resolved from a DNSLink TXT record
+	HopDNSLink = "dnslink"
+	// HopNode is a hop resolved by the ipfs node, used when the IPNS record
+	// can not be retrieved directly. The node resolves recursively, so a
+	// single node hop may span several names
+	HopNode = "node"
+)
+
+// ResolveHop is a single step taken while resolving a name
+type ResolveHop struct {
+	// Name is the name resolved in this step, such as /ipns/<peer-id>
+	Name string
+	// Value is the path the name resolved to
+	Value string
+	// Source is how the hop was resolved, one of HopIPNS, HopDNSLink or HopNode
+	Source string
+	// TTL is how long the hop may be cached for
+	TTL time.Duration
+	// Cached is true when the hop was served from the cache
+	Cached bool
+}
+
+// ResolveOpts is used to control a single resolution
+type ResolveOpts struct {
+	// Recursive follows names until an /ipfs/ path is reached,
+	// otherwise only a single step is resolved
+	Recursive bool
+	// MaxDepth limits the number of steps taken, defaults to DefaultDNSLinkMaxDepth
+	MaxDepth int
+	// NoCache bypasses the cache, although fresh results are still stored in it
+	NoCache bool
+}
+
+// ResolveResult is the outcome of resolving a name
+type ResolveResult struct {
+	// Path is the final resolved path
+	Path string
+	// Trace contains every step taken to reach the path
+	Trace []ResolveHop
+}
+
+// ResolverOpts is used to configure a Resolver
+type ResolverOpts struct {
+	// DNSLink is used to resolve domains, defaults to the system resolver
+	DNSLink *DNSLinkResolver
+	// CacheTTL is the longest any hop is cached for, and is used for hops
+	// without a TTL of their own. Defaults to DefaultResolveCacheTTL,
+	// and a negative value disables caching
+	CacheTTL time.Duration
+}
+
+// Resolver is used to resolve IPNS names and DNSLinks with control over recursion,
+// caching hops according to their TTL, and tracing each hop taken
+type Resolver struct {
+	im       Manager
+	dnslink  *DNSLinkResolver
+	cacheTTL time.Duration
+
+	mux   sync.RWMutex
+	cache map[string]cachedHop
+	// swept is when expired hops were last removed from the cache
+	swept time.Time
+}
+
+type cachedHop struct {
+	hop     ResolveHop
+	expires time.Time
+}
+
+// NewResolver is used to instantiate a Resolver
+func NewResolver(im Manager, opts ResolverOpts) *Resolver {
+	if opts.DNSLink == nil {
+		opts.DNSLink = NewDNSLinkResolver(nil, 0)
+	}
+	if opts.CacheTTL == 0 {
+		opts.CacheTTL = DefaultResolveCacheTTL
+	} else if opts.CacheTTL < 0 {
+		// hops with no TTL are not cached
+		opts.CacheTTL = 0
+	}
+	return &Resolver{
+		im:       im,
+		dnslink:  opts.DNSLink,
+		cacheTTL: opts.CacheTTL,
+		cache:    make(map[string]cachedHop),
+	}
+}
+
+// Resolve is used to resolve a name, given as a peer ID, domain, or /ipns/ path
+func (r *Resolver) Resolve(ctx context.Context, name string, opts ResolveOpts) (*ResolveResult, error) {
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultDNSLinkMaxDepth
+	}
+	result := &ResolveResult{Path: name}
+	if !strings.HasPrefix(name, "/") {
+		result.Path = "/ipns/" + name
+	}
+	for depth := 0; strings.HasPrefix(result.Path, "/ipns/"); depth++ {
+		if depth >= opts.MaxDepth {
+			return nil, fmt.Errorf("recursion limit of %v exceeded resolving '%s'", opts.MaxDepth, name)
+		}
+		if !opts.Recursive && depth == 1 {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		segment, rest := splitIPNSPath(result.Path)
+		hop, err := r.resolveHop(ctx, "/ipns/"+segment, opts.NoCache)
+		if err != nil {
+			return nil, err
+		}
+		result.Trace = append(result.Trace, hop)
+		result.Path = hop.Value + rest
+	}
+	return result, nil
+}
+
+// Purge is used to remove a name from the cache
+func (r *Resolver) Purge(name string) {
+	if !strings.HasPrefix(name, "/") {
+		name = "/ipns/" + name
+	}
+	r.mux.Lock()
+	delete(r.cache, name)
+	r.mux.Unlock()
+}
+
+// resolveHop resolves a single /ipns/<name>, without any trailing path
+func (r *Resolver) resolveHop(ctx context.Context, name string, noCache bool) (ResolveHop, error) {
+	if !noCache {
+		r.mux.RLock()
+		cached, ok := r.cache[name]
+		r.mux.RUnlock()
+		if ok && time.Now().Before(cached.expires) {
+			hop := cached.hop
+			hop.Cached = true
+			return hop, nil
+		} else if ok {
+			r.mux.Lock()
+			if current, ok := r.cache[name]; ok && !time.Now().Before(current.expires) {
+				delete(r.cache, name)
+			}
+			r.mux.Unlock()
+		}
+	}
+	hop := ResolveHop{Name: name, TTL: r.cacheTTL}
+	segment := strings.TrimPrefix(name, "/ipns/")
+	if IsDomain(segment) {
+		value, err := r.dnslink.ResolveOnce(ctx, segment)
+		if err != nil {
+			return hop, err
+		}
+		hop.Value, hop.Source = value, HopDNSLink
+	} else if _, err := peer.Decode(segment); err != nil {
+		return hop, fmt.Errorf("'%s' is neither a peer id or domain", segment)
+	} else if record, err := r.im.GetIPNSRecord(name); err == nil {
+		hop.Value, hop.Source = record.Value, HopIPNS
+		if record.TTL > 0 && record.TTL < hop.TTL {
+			hop.TTL = record.TTL
+		}
+		if untilExpiry := time.Until(record.Validity); untilExpiry < hop.TTL {
+			hop.TTL = untilExpiry
+		}
+	} else if invalid := new(IPNSValidationError); errors.As(err, &invalid) {
+		// a record that fails validation must not be replaced by the node's answer
+		return hop, err
+	} else {
+		// the record could not be retrieved, so fall back to the node,
+		// which may have it cached
+		value, err := r.im.Resolve(name)
+		if err != nil {
+			return hop, err
+		}
+		hop.Value, hop.Source = value, HopNode
+	}
+	if hop.TTL > 0 {
+		r.mux.Lock()
+		now := time.Now()
+		r.cache[name] = cachedHop{hop: hop, expires: now.Add(hop.TTL)}
+		r.sweep(now)
+		r.mux.Unlock()
+	}
+	return hop, nil
+}
+
+// sweep removes expired hops from the cache, at most once per cache TTL, so that
+// names which are not resolved again do not stay cached forever. It must be called
+// with the lock held
+func (r *Resolver) sweep(now time.Time) {
+	if now.Sub(r.swept) < r.cacheTTL {
+		return
+	}
+	r.swept = now
+	for name, cached := range r.cache {
+		if !now.Before(cached.expires) {
+			delete(r.cache, name)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package rtfs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/rtfs/v2"
+	"github.com/RTradeLtd/rtfs/v2/rtfstest"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestResolver(t *testing.T) {
+	node := rtfstest.NewNode()
+	// example.com -> second -> first -> /ipfs/testPIN
+	first := newIPNSName(t, node, testPIN, time.Now().Add(time.Hour), time.Minute)
+	second := newIPNSName(t, node, first+"/docs", time.Now().Add(time.Hour), 0)
+	dnslink := rtfs.NewDNSLinkResolver(fakeTXTResolver{
+		"_dnslink.example.com": {"dnslink=" + second},
+	}, 0)
+	resolver := rtfs.NewResolver(node, rtfs.ResolverOpts{DNSLink: dnslink, CacheTTL: time.Hour})
+
+	result, err := resolver.Resolve(context.Background(), "example.com", rtfs.ResolveOpts{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Path != "/ipfs/"+testPIN+"/docs" {
+		t.Fatalf("bad path %s", result.Path)
+	}
+	if len(result.Trace) != 3 {
+		t.Fatal("bad trace length")
+	}
+	for i, want := range []string{rtfs.HopDNSLink, rtfs.HopIPNS, rtfs.HopIPNS} {
+		if result.Trace[i].Source != want || result.Trace[i].Cached {
+			t.Fatalf("bad hop %+v", result.Trace[i])
+		}
+	}
+	// records without a ttl are cached until they expire, up to the cache ttl
+	if result.Trace[2].TTL != time.Minute || result.Trace[1].TTL < 59*time.Minute {
+		t.Fatal("record ttl not respected")
+	}
+
+	// single step resolution is served from the cache
+	result, err = resolver.Resolve(context.Background(), second+"/readme", rtfs.ResolveOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Path != first+"/docs/readme" || len(result.Trace) != 1 || !result.Trace[0].Cached {
+		t.Fatalf("bad single step result %+v", result)
+	}
+	if len(node.Calls("GetIPNSRecord")) != 2 {
+		t.Fatal("cache not used")
+	}
+	if _, err := resolver.Resolve(context.Background(), second, rtfs.ResolveOpts{NoCache: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(node.Calls("GetIPNSRecord")) != 3 {
+		t.Fatal("cache not bypassed")
+	}
+
+	if _, err := resolver.Resolve(context.Background(), "example.com", rtfs.ResolveOpts{Recursive: true, MaxDepth: 2}); err == nil {
+		t.Fatal("expected error exceeding max depth")
+	}
+	if _, err := resolver.Resolve(context.Background(), "/ipns/"+testRefsHash, rtfs.ResolveOpts{Recursive: true}); err == nil {
+		t.Fatal("expected error resolving unknown name")
+	}
+	result, err = resolver.Resolve(context.Background(), "/ipfs/"+testPIN, rtfs.ResolveOpts{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Path != "/ipfs/"+testPIN || len(result.Trace) != 0 {
+		t.Fatal("ipfs path should not be resolved")
+	}
+}
+
+// newIPNSName is used to store a record for a new name in the node's routing system
+func newIPNSName(t *testing.T, node rtfs.Manager, value string, eol time.Time, ttl time.Duration) string {
+	t.Helper()
+	pk, _, err := ci.GenerateKeyPair(ci.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := rtfs.NewIPNSRecord(pk, value, 0, eol, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := record.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "/ipns/" + id.Pretty()
+	if err := node.RoutingPut(name, data); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestResolver_Fallback(t *testing.T) {
+	node := rtfstest.NewNode()
+	valid := newIPNSName(t, node, testPIN, time.Now().Add(time.Hour), time.Minute)
+	expired := newIPNSName(t, node, testPIN, time.Now().Add(-time.Hour), time.Minute)
+	node.SetName(expired, "/ipfs/"+testRefsHash)
+	node.SetName("/ipns/"+testRefsHash, "/ipfs/"+testRefsHash)
+	resolver := rtfs.NewResolver(node, rtfs.ResolverOpts{CacheTTL: -1})
+
+	tests := []struct {
+		name       string
+		ipnsName   string
+		fail       error
+		wantSource string
+		wantErr    bool
+	}{
+		{"Record", valid, nil, rtfs.HopIPNS, false},
+		{"Not-Found", "/ipns/" + testRefsHash, nil, rtfs.HopNode, false},
+		{"Routing-Error", "/ipns/" + testRefsHash, errors.New("connection refused"), rtfs.HopNode, false},
+		{"Invalid-Record", expired, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node.Fail("RoutingGet", tt.fail)
+			result, err := resolver.Resolve(context.Background(), tt.ipnsName, rtfs.ResolveOpts{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				var invalid *rtfs.IPNSValidationError
+				if !errors.As(err, &invalid) {
+					t.Fatalf("Resolve() err = %v, want an IPNSValidationError", err)
+				}
+				return
+			}
+			if result.Trace[0].Source != tt.wantSource {
+				t.Fatalf("bad hop source %v, want %v", result.Trace[0].Source, tt.wantSource)
+			}
+			// a negative cache ttl disables caching, rather than giving hops a negative ttl
+			if result.Trace[0].TTL != 0 || result.Trace[0].Cached {
+				t.Fatalf("bad hop ttl %v, cached %v", result.Trace[0].TTL, result.Trace[0].Cached)
+			}
+		})
+	}
+}
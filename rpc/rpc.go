@@ -0,0 +1,230 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/rtfs/v2"
+)
+
+// DefaultTimeout is how long a call waits for a reply when its context has no deadline
+const DefaultTimeout = time.Second * 30
+
+// replySegment separates the request topic from the request ID in reply topics
+const replySegment = "/reply/"
+
+// Request is a call published to the server topic
+type Request struct {
+	ID     string          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+	// ReplyTo is the topic the response must be published to
+	ReplyTo string `json:"reply_to"`
+	// Deadline is when the caller stops waiting, in unix nanoseconds
+	Deadline int64 `json:"deadline"`
+}
+
+// Response is the reply to a request, published to its reply topic
+type Response struct {
+	ID     string          `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// RemoteError is returned by calls for which the handler returned an error
+type RemoteError struct {
+	Method  string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("rpc method '%s' failed: %s", e.Method, e.Message)
+}
+
+// Handler is used to serve a method. params is the raw json sent by the caller,
+// and the returned value is json encoded as the result
+type Handler func(ctx context.Context, params json.RawMessage) (interface{}, error)
+
+// Client is used to make calls to a server listening on a topic
+type Client struct {
+	im    rtfs.Manager
+	topic string
+}
+
+// NewClient is used to instantiate a client making calls to the server on topic
+func NewClient(im rtfs.Manager, topic string) *Client {
+	return &Client{im: im, topic: topic}
+}
+
+// Call is used to invoke method with params, decoding the result into out if it
+// is not nil. The call waits until the context deadline, or DefaultTimeout if unset
+func (c *Client) Call(ctx context.Context, method string, params, out interface{}) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+	// the subscription is tied to the call, and is closed once it returns
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	id, err := newRequestID()
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	req := Request{
+		ID:       id,
+		Method:   method,
+		ReplyTo:  c.topic + replySegment + id,
+		Deadline: deadline.UnixNano(),
+	}
+	if params != nil {
+		if req.Params, err = json.Marshal(params); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	replies, err := c.im.PubSubSubscribe(ctx, req.ReplyTo)
+	if err != nil {
+		return err
+	}
+	if err := c.im.PubSubPublishBytes(c.topic, data); err != nil {
+		return err
+	}
+	for {
+		select {
+		case msg, ok := <-replies:
+			if !ok {
+				return ctx.Err()
+			}
+			var resp Response
+			if err := json.Unmarshal(msg.Data, &resp); err != nil || resp.ID != id {
+				continue
+			}
+			if resp.Error != "" {
+				return &RemoteError{Method: method, Message: resp.Error}
+			}
+			if out == nil || len(resp.Result) == 0 {
+				return nil
+			}
+			return json.Unmarshal(resp.Result, out)
+		case <-ctx.Done():
+			return fmt.Errorf("rpc method '%s' timed out: %s", method, ctx.Err().Error())
+		}
+	}
+}
+
+// Server is used to serve requests published to a topic
+type Server struct {
+	im    rtfs.Manager
+	topic string
+
+	mux      sync.RWMutex
+	handlers map[string]Handler
+}
+
+// NewServer is used to instantiate a server for requests published to topic
+func NewServer(im rtfs.Manager, topic string) *Server {
+	return &Server{
+		im:       im,
+		topic:    topic,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Handle is used to register the handler for a method, replacing any existing handler
+func (s *Server) Handle(method string, handler Handler) {
+	s.mux.Lock()
+	s.handlers[method] = handler
+	s.mux.Unlock()
+}
+
+// Serve is used to process requests until the context is cancelled.
+// Each request is handled in its own goroutine, with a context that
+// expires at the caller's deadline
+func (s *Server) Serve(ctx context.Context) error {
+	requests, err := s.im.PubSubSubscribe(ctx, s.topic)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for msg := range requests {
+		var req Request
+		if err := json.Unmarshal(msg.Data, &req); err != nil || req.ID == "" {
+			continue
+		}
+		// only reply on topics belonging to this server, so that
+		// requests can not be used to publish to arbitrary topics
+		if req.ReplyTo != s.topic+replySegment+req.ID {
+			continue
+		}
+		deadline := time.Unix(0, req.Deadline)
+		if !deadline.After(time.Now()) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reqCtx, cancel := context.WithDeadline(ctx, deadline)
+			defer cancel()
+			resp := s.handle(reqCtx, req)
+			// past the deadline the caller has stopped waiting for a reply
+			if reqCtx.Err() != nil {
+				return
+			}
+			// failed replies are indistinguishable from a timeout to the caller
+			_ = s.reply(req, resp)
+		}()
+	}
+	return ctx.Err()
+}
+
+// handle dispatches a request to its handler
+func (s *Server) handle(ctx context.Context, req Request) Response {
+	resp := Response{ID: req.ID}
+	s.mux.RLock()
+	handler, ok := s.handlers[req.Method]
+	s.mux.RUnlock()
+	if !ok {
+		resp.Error = fmt.Sprintf("unknown method '%s'", req.Method)
+		return resp
+	}
+	result, err := handler(ctx, req.Params)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	if result != nil {
+		if resp.Result, err = json.Marshal(result); err != nil {
+			resp.Error = err.Error()
+		}
+	}
+	return resp
+}
+
+func (s *Server) reply(req Request, resp Response) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return s.im.PubSubPublishBytes(req.ReplyTo, data)
+}
+
+// newRequestID returns a random identifier used to correlate a reply with its request
+func newRequestID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.New("failed to generate request id")
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,87 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/rtfs/v2/rpc"
+	"github.com/RTradeLtd/rtfs/v2/rtfstest"
+)
+
+func TestRPC(t *testing.T) {
+	ps := rtfstest.NewNode()
+	server := rpc.NewServer(ps, "coordination")
+	server.Handle("add", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var nums []int
+		if err := json.Unmarshal(params, &nums); err != nil {
+			return nil, err
+		}
+		var sum int
+		for _, n := range nums {
+			sum += n
+		}
+		return sum, nil
+	})
+	server.Handle("fail", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return nil, errors.New("handler failed")
+	})
+	server.Handle("slow", func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- server.Serve(ctx) }()
+	// wait for the server to subscribe
+	for len(ps.Calls("PubSubSubscribe")) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	client := rpc.NewClient(ps, "coordination")
+	var sum int
+	if err := client.Call(context.Background(), "add", []int{1, 2, 3}, &sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum != 6 {
+		t.Fatalf("Call() = %v, want 6", sum)
+	}
+	var remoteErr *rpc.RemoteError
+	if err := client.Call(context.Background(), "fail", nil, nil); !errors.As(err, &remoteErr) || remoteErr.Message != "handler failed" {
+		t.Fatalf("Call() err = %v, want remote error", err)
+	}
+	if err := client.Call(context.Background(), "missing", nil, nil); !errors.As(err, &remoteErr) {
+		t.Fatalf("Call() err = %v, want remote error", err)
+	}
+	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer timeoutCancel()
+	if err := client.Call(timeoutCtx, "slow", nil, nil); err == nil || errors.As(err, &remoteErr) {
+		t.Fatalf("Call() err = %v, want timeout", err)
+	}
+
+	// requests asking for replies outside the server's reply topics are ignored
+	deadline := time.Now().Add(time.Minute).UnixNano()
+	if err := ps.PubSubPublishBytes("coordination", []byte(fmt.Sprintf(
+		`{"id":"abc","method":"add","params":[1],"reply_to":"elsewhere","deadline":%d}`, deadline))); err != nil {
+		t.Fatal(err)
+	}
+	// requests are read in order, so once a later call is answered the server has
+	// handled the request, and any reply it sent is published shortly after
+	if err := client.Call(context.Background(), "add", []int{1}, &sum); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); time.Since(start) < 100*time.Millisecond; time.Sleep(time.Millisecond) {
+		for _, topic := range ps.Calls("PubSubPublishBytes") {
+			if topic == "elsewhere" {
+				t.Fatal("server replied on arbitrary topic")
+			}
+		}
+	}
+	cancel()
+	if err := <-served; err != context.Canceled {
+		t.Fatal(err)
+	}
+}
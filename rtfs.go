@@ -1,21 +1,66 @@
 package rtfs
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	ipfsapi "github.com/RTradeLtd/go-ipfs-api/v3"
+	"github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// routingEventValue is the query event type containing a routing value
+const routingEventValue = 5
+
+// ErrRoutingNotFound is returned by RoutingGet when no value is stored under the key
+var ErrRoutingNotFound = errors.New("routing: not found")
+
+// NodeKey is a key held in the keystore of an ipfs node
+type NodeKey struct {
+	Name string
+	ID   string `json:"Id"`
+}
+
+// Message is a message received from a pubsub topic
+type Message struct {
+	// From is the peer that sent the message
+	From peer.ID
+	// Seqno is the sequence number assigned to the message by the sender
+	Seqno uint64
+	// Topic is the topic the message was received on
+	Topic string
+	Data  []byte
+}
+
+// pubsub resubscription backoff bounds
+const (
+	pubsubMinBackoff = time.Second
+	pubsubMaxBackoff = time.Minute
 )
 
 // IpfsManager is our helper wrapper for IPFS
 type IpfsManager struct {
-	shell       *ipfsapi.Shell
+	shell *ipfsapi.Shell
+	// streamShell is used for long lived requests, which
+	// must not be subject to the request timeout
+	streamShell *ipfsapi.Shell
 	nodeAPIAddr string
+	// mfsRoot is the mutable file system directory operations are scoped to
+	mfsRoot string
 }
 
 // NewManager is used to instantiate IpfsManager with a connection to an ipfs api.
@@ -24,12 +69,13 @@ type IpfsManager struct {
 // in situations such as interacting with Nexus' delegator to talk with private ipfs
 // networks which use non-standard connection methods.
 func NewManager(ipfsURL, token string, timeout time.Duration) (*IpfsManager, error) {
-	var sh *ipfsapi.Shell
-	if token != "" {
-		sh = ipfsapi.NewDirectShell(ipfsURL).WithAuthorization(token, nil)
-	} else {
-		sh = ipfsapi.NewShell(ipfsURL)
+	newShell := func() *ipfsapi.Shell {
+		if token != "" {
+			return ipfsapi.NewDirectShell(ipfsURL).WithAuthorization(token, nil)
+		}
+		return ipfsapi.NewShell(ipfsURL)
 	}
+	sh := newShell()
 	// validate we have an active connection
 	if _, err := sh.ID(); err != nil {
 		return nil, fmt.Errorf("failed to connect to ipfs node at '%s': %s", ipfsURL, err.Error())
@@ -39,6 +85,7 @@ func NewManager(ipfsURL, token string, timeout time.Duration) (*IpfsManager, err
 	// instantiate and return manager
 	return &IpfsManager{
 		shell:       sh,
+		streamShell: newShell(),
 		nodeAPIAddr: ipfsURL,
 	}, nil
 }
@@ -56,6 +103,66 @@ func (im *IpfsManager) AddDir(dir string) (string, error) {
 	return im.shell.AddDir(dir)
 }
 
+// AddDirWithOptions is used to add a local directory to ipfs, with control over which
+// files are included, how symlinks are handled, and progress reporting. The directory
+// is streamed to the node, opening each file only as it is sent
+func (im *IpfsManager) AddDirWithOptions(dir string, opts AddDirOpts) (string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	} else if !info.IsDir() {
+		return "", fmt.Errorf("'%s' is not a directory", dir)
+	}
+	walker, err := newDirWalker(opts)
+	if err != nil {
+		return "", err
+	}
+	root, err := walker.dir(dir, "", nil)
+	if err != nil {
+		return "", err
+	}
+	return im.addDirectory(filepath.Base(filepath.Clean(dir)), root, opts.AddOpts)
+}
+
+// AddReaders is used to add files held in memory, or being received, as a single directory
+// called name, without writing them to disk. Readers are consumed in order of their path,
+// and any exclude, hidden file, and progress options are applied as with AddDirWithOptions
+func (im *IpfsManager) AddReaders(name string, entries []AddEntry, opts AddDirOpts) (string, error) {
+	if name == "" {
+		closeEntries(entries)
+		return "", errors.New("directory name is empty")
+	}
+	root, err := newReaderDirectory(entries, opts)
+	if err != nil {
+		closeEntries(entries)
+		return "", err
+	}
+	hash, err := im.addDirectory(name, root, opts.AddOpts)
+	if err != nil {
+		closeEntries(entries)
+		return "", err
+	}
+	return hash, nil
+}
+
+// AddFS is used to add the contents of a file system, such as an embed.FS, as a single
+// directory called name. As link targets can not be read from an fs.FS, symlinks are
+// left out unless opts.Symlinks is SymlinksFollow
+func (im *IpfsManager) AddFS(name string, fsys fs.FS, opts AddDirOpts) (string, error) {
+	if name == "" {
+		return "", errors.New("directory name is empty")
+	}
+	walker, err := newDirWalker(opts)
+	if err != nil {
+		return "", err
+	}
+	root, err := walker.fsDir(fsys, ".", 0)
+	if err != nil {
+		return "", err
+	}
+	return im.addDirectory(name, root, opts.AddOpts)
+}
+
 // DagPut is used to store data as an ipld object
 func (im *IpfsManager) DagPut(data interface{}, encoding, kind string) (string, error) {
 	return im.shell.DagPut(data, encoding, kind)
@@ -63,16 +170,84 @@ func (im *IpfsManager) DagPut(data interface{}, encoding, kind string) (string,
 
 // DagGet is used to get an ipld object
 func (im *IpfsManager) DagGet(cid string, out interface{}) error {
+	cid, err := cidArg(cid)
+	if err != nil {
+		return err
+	}
 	return im.shell.DagGet(cid, out)
 }
 
+// DagPutWithOptions is used to store data as an ipld object, with control over the codecs,
+// hash function and pinning. data may be a []byte, string or io.Reader holding data encoded
+// with opts.InputCodec, otherwise it is json encoded and stored as a dag-json input
+func (im *IpfsManager) DagPutWithOptions(data interface{}, opts DagPutOpts) (string, error) {
+	var r io.Reader
+	switch data := data.(type) {
+	case []byte:
+		r = bytes.NewReader(data)
+	case string:
+		r = strings.NewReader(data)
+	case io.Reader:
+		r = data
+	default:
+		marshaled, err := json.Marshal(data)
+		if err != nil {
+			return "", err
+		}
+		r = bytes.NewReader(marshaled)
+		opts.InputCodec = CodecDagJSON
+	}
+	if err := opts.defaults(); err != nil {
+		return "", err
+	}
+	body := singleFileReaderBody(r)
+	var out struct {
+		Cid struct {
+			Target string `json:"/"`
+		}
+	}
+	// both the current and legacy option names are sent, as nodes ignore those they do not know
+	if err := im.shell.Request("dag/put").
+		Option("input-codec", opts.InputCodec).
+		Option("store-codec", opts.StoreCodec).
+		Option("input-enc", legacyCodecNames[opts.InputCodec]).
+		Option("format", legacyCodecNames[opts.StoreCodec]).
+		Option("hash", opts.Hash).
+		Option("pin", opts.Pin).
+		Body(body).
+		Exec(context.Background(), &out); err != nil {
+		return "", err
+	}
+	return out.Cid.Target, nil
+}
+
+// DagGetPath is used to get the ipld object at a path, given as either <cid>/a/b
+// or /ipfs/<cid>/a/b, decoding it into out. Links are decoded into cid.Cid fields
+func (im *IpfsManager) DagGetPath(p string, out interface{}) error {
+	root, rest, err := ParseDagPath(p)
+	if err != nil {
+		return err
+	}
+	ref := root.String()
+	if rest != "" {
+		ref += "/" + rest
+	}
+	return im.shell.Request("dag/get", ref).Option("output-codec", CodecDagJSON).Exec(context.Background(), out)
+}
+
+// BlockPut is used to store a raw block, such as an encoded dag-pb node. format is the
+// codec of the block, or "v0" to store a dag-pb block under a version 0 cid
+func (im *IpfsManager) BlockPut(data []byte, format string) (string, error) {
+	return im.shell.BlockPut(data, format, HashSHA256, -1)
+}
+
 // Cat is used to get cat an ipfs object
 func (im *IpfsManager) Cat(cid string) ([]byte, error) {
-	var (
-		r   io.ReadCloser
-		err error
-	)
-	r, err = im.shell.Cat(cid)
+	cid, err := cidArg(cid)
+	if err != nil {
+		return nil, err
+	}
+	r, err := im.shell.Cat(cid)
 	if err != nil {
 		return nil, err
 	}
@@ -82,6 +257,10 @@ func (im *IpfsManager) Cat(cid string) ([]byte, error) {
 
 // Stat is used to retrieve the stats about an object
 func (im *IpfsManager) Stat(hash string) (*ipfsapi.ObjectStats, error) {
+	hash, err := cidArg(hash)
+	if err != nil {
+		return nil, err
+	}
 	return im.shell.ObjectStat(hash)
 }
 
@@ -89,17 +268,79 @@ func (im *IpfsManager) Stat(hash string) (*ipfsapi.ObjectStats, error) {
 // path really means the name of the link
 // create is used to specify whether intermediary nodes should be generated
 func (im *IpfsManager) PatchLink(root, path, childHash string, create bool) (string, error) {
+	root, err := cidArg(root)
+	if err != nil {
+		return "", err
+	}
+	if childHash, err = cidArg(childHash); err != nil {
+		return "", err
+	}
 	return im.shell.PatchLink(root, path, childHash, create)
 }
 
+// PatchRmLink is used to remove the named link from an object, returning the new object's hash
+func (im *IpfsManager) PatchRmLink(root, name string) (string, error) {
+	root, err := cidArg(root)
+	if err != nil {
+		return "", err
+	}
+	return im.shell.Patch(root, "rm-link", name)
+}
+
+// Patch is used to apply a sequence of operations to an object, returning the hash
+// produced by each operation, the last being the final result. Operations are applied
+// one at a time, so if one fails the hashes produced so far are returned with the error
+func (im *IpfsManager) Patch(root string, ops []PatchOp) ([]string, error) {
+	// validate every hash up front, so that a malformed one can not leave the patch half applied
+	root, err := cidArg(root)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		if err := op.validate(); err != nil {
+			return nil, fmt.Errorf("patch operation %v failed: %s", i, err.Error())
+		}
+	}
+	hashes := make([]string, 0, len(ops))
+	current := root
+	for i, op := range ops {
+		var err error
+		switch op.Type {
+		case PatchOpAddLink:
+			current, err = im.PatchLink(current, op.Name, op.Hash, op.Create)
+		case PatchOpRmLink:
+			current, err = im.PatchRmLink(current, op.Name)
+		case PatchOpSetData:
+			current, err = im.SetData(current, op.Data)
+		case PatchOpAppendData:
+			current, err = im.AppendData(current, op.Data)
+		default:
+			err = fmt.Errorf("unknown patch operation '%s'", op.Type)
+		}
+		if err != nil {
+			return hashes, fmt.Errorf("patch operation %v failed: %s", i, err.Error())
+		}
+		hashes = append(hashes, current)
+	}
+	return hashes, nil
+}
+
 // AppendData is used to modify the raw data within an object, to a max of 1MB
 // Anything larger than 1MB will not be respected by the rest of the network
 func (im *IpfsManager) AppendData(root string, data interface{}) (string, error) {
+	root, err := cidArg(root)
+	if err != nil {
+		return "", err
+	}
 	return im.shell.PatchData(root, false, data)
 }
 
 // SetData is used to set the data field of an ipfs object
 func (im *IpfsManager) SetData(root string, data interface{}) (string, error) {
+	root, err := cidArg(root)
+	if err != nil {
+		return "", err
+	}
 	return im.shell.PatchData(root, true, data)
 }
 
@@ -111,6 +352,10 @@ func (im *IpfsManager) NewObject(template string) (string, error) {
 // Pin is a wrapper method to pin a hash.
 // pinning prevents GC and persistently stores on disk
 func (im *IpfsManager) Pin(hash string) error {
+	hash, err := cidArg(hash)
+	if err != nil {
+		return err
+	}
 	return im.shell.Pin(hash)
 }
 
@@ -122,6 +367,13 @@ func (im *IpfsManager) Pin(hash string) error {
 //
 // returns the new pin path
 func (im *IpfsManager) PinUpdate(from, to string) (string, error) {
+	from, err := cidArg(from)
+	if err != nil {
+		return "", err
+	}
+	if to, err = cidArg(to); err != nil {
+		return "", err
+	}
 	out, err := im.shell.PinUpdate(from, to)
 	if err != nil {
 		return "", err
@@ -132,36 +384,259 @@ func (im *IpfsManager) PinUpdate(from, to string) (string, error) {
 	return out["Pins"][1], nil
 }
 
-// CheckPin checks whether or not a pin is present
+// CheckPin checks whether or not a pin is present. A path is first
+// resolved by the node, and the object it points to checked
 func (im *IpfsManager) CheckPin(hash string) (bool, error) {
+	c, rest, err := ParseDagPath(hash)
+	if err != nil {
+		return false, err
+	}
+	if rest != "" {
+		resolved, err := im.shell.ResolvePath(c.String() + "/" + rest)
+		if err != nil {
+			return false, err
+		}
+		if c, err = cid.Decode(resolved); err != nil {
+			return false, err
+		}
+	}
 	pins, err := im.shell.Pins()
 	if err != nil {
 		return false, err
 	}
-	if info := pins[hash]; info.Type != "" {
-		return true, nil
+	// pins are listed in the form the node prefers, which may differ from hash
+	// in version and base, so they are compared by multihash
+	for pin, info := range pins {
+		if info.Type == "" {
+			continue
+		}
+		if pc, err := cid.Decode(pin); err == nil && bytes.Equal(pc.Hash(), c.Hash()) {
+			return true, nil
+		}
 	}
 	return false, nil
 }
 
 // Publish is used for fine grained control over IPNS record publishing
 func (im *IpfsManager) Publish(contentHash, keyName string, lifetime, ttl time.Duration, resolve bool) (*ipfsapi.PublishResponse, error) {
+	if !strings.HasPrefix(contentHash, "/ipns/") {
+		var err error
+		if contentHash, err = NormalizeIPFSPath(contentHash); err != nil {
+			return nil, err
+		}
+	}
 	return im.shell.PublishWithDetails(contentHash, keyName, lifetime, ttl, resolve)
 }
 
-// Resolve is used to resolve an IPNS hash
+// KeyImport is used to import a private key into the keystore of the ipfs node
+func (im *IpfsManager) KeyImport(keyName string, pk ci.PrivKey) (*NodeKey, error) {
+	pkBytes, err := pk.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	body := singleFileBody(pkBytes)
+	var out NodeKey
+	if err := im.shell.Request("key/import", keyName).Body(body).Exec(context.Background(), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// KeyList is used to list the keys held in the keystore of the ipfs node
+func (im *IpfsManager) KeyList() ([]NodeKey, error) {
+	var out struct{ Keys []NodeKey }
+	if err := im.shell.Request("key/list").Option("l", true).Exec(context.Background(), &out); err != nil {
+		return nil, err
+	}
+	return out.Keys, nil
+}
+
+// KeyRemove is used to remove a key from the keystore of the ipfs node
+func (im *IpfsManager) KeyRemove(keyName string) error {
+	var out struct{ Keys []NodeKey }
+	return im.shell.Request("key/rm", keyName).Exec(context.Background(), &out)
+}
+
+// RoutingGet is used to retrieve the value stored in the routing system under key,
+// such as the IPNS record for /ipns/<peer-id>
+func (im *IpfsManager) RoutingGet(key string) ([]byte, error) {
+	resp, err := im.shell.Request("routing/get", key).Send(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+	if resp.Error != nil {
+		// the node reports a missing value with an error message, not a code
+		if resp.Error.Message == ErrRoutingNotFound.Error() {
+			return nil, ErrRoutingNotFound
+		}
+		return nil, resp.Error
+	}
+	// the response is a stream of query events, one of which holds the value
+	dec := json.NewDecoder(resp.Output)
+	for {
+		var event struct {
+			Type  int
+			Extra string
+		}
+		if err := dec.Decode(&event); err == io.EOF {
+			return nil, ErrRoutingNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		if event.Type == routingEventValue {
+			return base64.StdEncoding.DecodeString(event.Extra)
+		}
+	}
+}
+
+// RoutingPut is used to store a value in the routing system under key,
+// such as a signed IPNS record under /ipns/<peer-id>
+func (im *IpfsManager) RoutingPut(key string, value []byte) error {
+	body := singleFileBody(value)
+	resp, err := im.shell.Request("routing/put", key).Body(body).Send(context.Background())
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	if resp.Error != nil {
+		return resp.Error
+	}
+	return nil
+}
+
+// GetIPNSRecord is used to retrieve and validate the IPNS record for a name,
+// given as either a peer ID or an /ipns/ path. Records failing validation are
+// not returned, and the error is an *IPNSValidationError. See UnmarshalIPNSRecord
+// to inspect such records regardless
+func (im *IpfsManager) GetIPNSRecord(name string) (*IPNSRecord, error) {
+	id, err := peer.Decode(strings.TrimPrefix(name, "/ipns/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ipns name '%s': %s", name, err.Error())
+	}
+	data, err := im.RoutingGet("/ipns/" + id.Pretty())
+	if err != nil {
+		return nil, err
+	}
+	record, err := UnmarshalIPNSRecord(data)
+	if err != nil {
+		return nil, &IPNSValidationError{Name: name, Err: err}
+	}
+	if err := record.Validate(id); err != nil {
+		return nil, &IPNSValidationError{Name: name, Err: err}
+	}
+	pub, err := record.PublicKeyFor(id)
+	if err != nil {
+		return nil, err
+	}
+	record.KeyType = pub.Type().String()
+	return record, nil
+}
+
+// Resolve is used to resolve an IPNS hash. /ipfs/ paths are validated before
+// being sent to the node, while names are passed through as is
 func (im *IpfsManager) Resolve(hash string) (string, error) {
+	if strings.HasPrefix(hash, "/ipfs/") {
+		var err error
+		if hash, err = NormalizeIPFSPath(hash); err != nil {
+			return "", err
+		}
+	}
 	return im.shell.Resolve(hash)
 }
 
-// PubSubPublish is used to publish a a message to the given topic
+// PubSubPublish is used to publish a a message to the given topic.
+// Empty messages are allowed
 func (im *IpfsManager) PubSubPublish(topic string, data string) error {
 	if topic == "" {
 		return errors.New("topic is empty")
-	} else if data == "" {
-		return errors.New("data is empty")
 	}
-	return im.shell.PubSubPublish(topic, data)
+	// the message is sent as an argument rather than the request body, as nodes
+	// split a body into one message per line
+	resp, err := im.shell.Request("pubsub/pub", topic, data).Send(context.Background())
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	if resp.Error != nil {
+		return resp.Error
+	}
+	return nil
+}
+
+// PubSubPublishBytes is used to publish arbitrary binary data to the given topic,
+// without it needing to be encoded first. The data may be empty, or contain newlines
+func (im *IpfsManager) PubSubPublishBytes(topic string, data []byte) error {
+	return im.PubSubPublish(topic, string(data))
+}
+
+// PubSubTopics is used to list the topics the node is subscribed to
+func (im *IpfsManager) PubSubTopics() ([]string, error) {
+	var out struct{ Strings []string }
+	if err := im.shell.Request("pubsub/ls").Exec(context.Background(), &out); err != nil {
+		return nil, err
+	}
+	return out.Strings, nil
+}
+
+// PubSubPeers is used to list the peers the node knows to be subscribed to topic.
+// If topic is empty, peers subscribed to any topic are listed
+func (im *IpfsManager) PubSubPeers(topic string) ([]peer.ID, error) {
+	var (
+		out  struct{ Strings []string }
+		args []string
+	)
+	if topic != "" {
+		args = append(args, topic)
+	}
+	if err := im.shell.Request("pubsub/peers", args...).Exec(context.Background(), &out); err != nil {
+		return nil, err
+	}
+	peers := make([]peer.ID, 0, len(out.Strings))
+	for _, p := range out.Strings {
+		id, err := peer.Decode(p)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, id)
+	}
+	return peers, nil
+}
+
+// PubSubSubscribe is used to subscribe to a topic. Messages are delivered on the returned
+// channel until the context is cancelled, at which point the channel is closed. If the
+// connection to the node is lost, the subscription is automatically re-established
+func (im *IpfsManager) PubSubSubscribe(ctx context.Context, topic string) (<-chan Message, error) {
+	if topic == "" {
+		return nil, errors.New("topic is empty")
+	}
+	resp, err := im.pubsubSubscribe(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	messages := make(chan Message)
+	go func() {
+		defer close(messages)
+		backoff := pubsubMinBackoff
+		for {
+			if resp != nil {
+				im.pubsubReceive(ctx, topic, resp, messages)
+				backoff = pubsubMinBackoff
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if resp, err = im.pubsubSubscribe(ctx, topic); err != nil {
+				resp = nil
+				if backoff *= 2; backoff > pubsubMaxBackoff {
+					backoff = pubsubMaxBackoff
+				}
+			}
+		}
+	}()
+	return messages, nil
 }
 
 // CustomRequest is used to make a custom request
@@ -196,6 +671,10 @@ func (im *IpfsManager) SwarmConnect(ctx context.Context, addrs ...string) error
 
 // Refs is used to retrieve references of a hash
 func (im *IpfsManager) Refs(hash string, recursive, unique bool) ([]string, error) {
+	hash, err := cidArg(hash)
+	if err != nil {
+		return nil, err
+	}
 	refs, err := im.shell.Refs(hash, recursive, unique)
 	if err != nil {
 		return nil, err
@@ -207,9 +686,120 @@ func (im *IpfsManager) Refs(hash string, recursive, unique bool) ([]string, erro
 	return references, nil
 }
 
+// RefsStream is used to stream the refs of an object in the order the node emits them.
+// The channel is closed once all refs have been sent, or the context is cancelled
+func (im *IpfsManager) RefsStream(ctx context.Context, hash string, opts RefsOpts) (<-chan RefResult, error) {
+	hash, err := cidArg(hash)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Edges && opts.Format != "" {
+		return nil, errors.New("edges can not be used with a custom format")
+	}
+	req := im.streamShell.Request("refs", hash).
+		Option("recursive", opts.Recursive || opts.MaxDepth > 0).
+		Option("unique", opts.Unique).
+		Option("edges", opts.Edges)
+	if opts.MaxDepth > 0 {
+		req = req.Option("max-depth", opts.MaxDepth)
+	}
+	if opts.Format != "" {
+		req = req.Option("format", opts.Format)
+	}
+	resp, err := req.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		resp.Close()
+		return nil, resp.Error
+	}
+	refs := make(chan RefResult)
+	go func() {
+		defer close(refs)
+		defer resp.Close()
+		dec := json.NewDecoder(resp.Output)
+		for {
+			var raw struct{ Ref, Err string }
+			if err := dec.Decode(&raw); err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					select {
+					case refs <- RefResult{Err: err}:
+					case <-ctx.Done():
+					}
+				}
+				return
+			}
+			result := RefResult{Ref: raw.Ref}
+			if raw.Err != "" {
+				result.Err = errors.New(raw.Err)
+			}
+			select {
+			case refs <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return refs, nil
+}
+
+// DagLinks is used to list the links of a single ipld object, in the order they appear.
+// Raw blocks have no links, and sizes are only available for dag-pb objects given by cid,
+// as the type of an object given by path is not known until the node resolves it
+func (im *IpfsManager) DagLinks(hash string) ([]DagLink, error) {
+	c, rest, err := ParseDagPath(hash)
+	if err != nil {
+		return nil, err
+	}
+	ref := c.String()
+	if rest != "" {
+		ref += "/" + rest
+	} else if c.Type() == cid.Raw {
+		return nil, nil
+	} else if c.Type() == cid.DagProtobuf {
+		var out struct{ Links []DagLink }
+		if err := im.shell.Request("object/links", ref).Exec(context.Background(), &out); err != nil {
+			return nil, err
+		}
+		return out.Links, nil
+	}
+	resp, err := im.shell.Request("refs", ref).Option("format", "<dst> <linkname>").Send(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	var links []DagLink
+	dec := json.NewDecoder(resp.Output)
+	for {
+		var ref struct{ Ref, Err string }
+		if err := dec.Decode(&ref); err == io.EOF {
+			return links, nil
+		} else if err != nil {
+			return nil, err
+		} else if ref.Err != "" {
+			return nil, errors.New(ref.Err)
+		}
+		// link names may contain spaces, but cids never do
+		parts := strings.SplitN(ref.Ref, " ", 2)
+		link := DagLink{Hash: parts[0]}
+		if len(parts) == 2 {
+			link.Name = parts[1]
+		}
+		links = append(links, link)
+	}
+}
+
 // DeduplicatedSize will calculate the deduplicated size of an object.
 // This is limited to UnixFS object types
 func (im *IpfsManager) DeduplicatedSize(hash string) (int, error) {
+	hash, err := cidArg(hash)
+	if err != nil {
+		return 0, err
+	}
 	refs, err := im.Refs(hash, true, true)
 	if err != nil {
 		return 0, err
@@ -224,3 +814,99 @@ func (im *IpfsManager) DeduplicatedSize(hash string) (int, error) {
 	}
 	return totalRefSize, nil
 }
+
+// singleFileBody is used to build a request body holding data as a single unnamed file
+func singleFileBody(data []byte) *files.MultiFileReader {
+	return files.NewMultiFileReader(
+		files.NewSliceDirectory([]files.DirEntry{files.FileEntry("", files.NewBytesFile(data))}),
+		true,
+	)
+}
+
+// singleFileReaderBody is used to build a request body streaming r as a single unnamed file
+func singleFileReaderBody(r io.Reader) *files.MultiFileReader {
+	return files.NewMultiFileReader(
+		files.NewSliceDirectory([]files.DirEntry{files.FileEntry("", files.NewReaderFile(r))}),
+		true,
+	)
+}
+
+// addDirectory adds a directory recursively, returning the hash of the final object added
+func (im *IpfsManager) addDirectory(name string, dir files.Directory, options []ipfsapi.AddOpts) (string, error) {
+	body := files.NewMultiFileReader(files.NewSliceDirectory([]files.DirEntry{files.FileEntry(name, dir)}), true)
+	req := im.streamShell.Request("add").Option("recursive", true)
+	for _, option := range options {
+		if err := option(req); err != nil {
+			return "", err
+		}
+	}
+	resp, err := req.Body(body).Send(context.Background())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Close()
+	if resp.Error != nil {
+		return "", resp.Error
+	}
+	var final string
+	dec := json.NewDecoder(resp.Output)
+	for {
+		var out struct{ Hash string }
+		if err := dec.Decode(&out); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		// progress events carry no hash
+		if out.Hash != "" {
+			final = out.Hash
+		}
+	}
+	if final == "" {
+		return "", errors.New("no results received")
+	}
+	return final, nil
+}
+
+// pubsubSubscribe opens a subscription stream for topic
+func (im *IpfsManager) pubsubSubscribe(ctx context.Context, topic string) (*ipfsapi.Response, error) {
+	resp, err := im.streamShell.Request("pubsub/sub", topic).Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		resp.Close()
+		return nil, resp.Error
+	}
+	return resp, nil
+}
+
+// pubsubReceive delivers messages from a subscription stream until it ends
+func (im *IpfsManager) pubsubReceive(ctx context.Context, topic string, resp *ipfsapi.Response, messages chan<- Message) {
+	defer resp.Close()
+	dec := json.NewDecoder(resp.Output)
+	for {
+		var raw struct {
+			From  []byte `json:"from"`
+			Data  []byte `json:"data"`
+			Seqno []byte `json:"seqno"`
+		}
+		if err := dec.Decode(&raw); err != nil {
+			return
+		}
+		from, err := peer.IDFromBytes(raw.From)
+		if err != nil {
+			// skip keep-alive and malformed messages
+			continue
+		}
+		msg := Message{From: from, Topic: topic, Data: raw.Data}
+		for _, b := range raw.Seqno {
+			msg.Seqno = msg.Seqno<<8 | uint64(b)
+		}
+		select {
+		case messages <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -5,9 +5,12 @@ package rtfs
 import (
 	"context"
 	"io"
+	"io/fs"
 	"time"
 
 	ipfsapi "github.com/RTradeLtd/go-ipfs-api/v3"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
 )
 
 // Manager provides functions for interacting with IPFS
@@ -18,10 +21,32 @@ type Manager interface {
 	Add(r io.Reader, options ...ipfsapi.AddOpts) (string, error)
 	// AddDir is used to add a directory to ipfs
 	AddDir(dir string) (string, error)
+	// AddDirWithOptions is used to add a local directory to ipfs, with control over which
+	// files are included, how symlinks are handled, and progress reporting. The directory
+	// is streamed to the node, opening each file only as it is sent
+	AddDirWithOptions(dir string, opts AddDirOpts) (string, error)
+	// AddReaders is used to add files held in memory, or being received, as a single directory
+	// called name, without writing them to disk. Readers are consumed in order of their path,
+	// and any exclude, hidden file, and progress options are applied as with AddDirWithOptions
+	AddReaders(name string, entries []AddEntry, opts AddDirOpts) (string, error)
+	// AddFS is used to add the contents of a file system, such as an embed.FS, as a single
+	// directory called name. As link targets can not be read from an fs.FS, symlinks are
+	// left out unless opts.Symlinks is SymlinksFollow
+	AddFS(name string, fsys fs.FS, opts AddDirOpts) (string, error)
 	// DagPut is used to store data as an ipld object
 	DagPut(data interface{}, encoding, kind string) (string, error)
 	// DagGet is used to get an ipld object
 	DagGet(cid string, out interface{}) error
+	// DagPutWithOptions is used to store data as an ipld object, with control over the codecs,
+	// hash function and pinning. data may be a []byte, string or io.Reader holding data encoded
+	// with opts.InputCodec, otherwise it is json encoded and stored as a dag-json input
+	DagPutWithOptions(data interface{}, opts DagPutOpts) (string, error)
+	// DagGetPath is used to get the ipld object at a path, given as either <cid>/a/b
+	// or /ipfs/<cid>/a/b, decoding it into out. Links are decoded into cid.Cid fields
+	DagGetPath(p string, out interface{}) error
+	// BlockPut is used to store a raw block, such as an encoded dag-pb node. format is the
+	// codec of the block, or "v0" to store a dag-pb block under a version 0 cid
+	BlockPut(data []byte, format string) (string, error)
 	// Cat is used to get cat an ipfs object
 	Cat(cid string) ([]byte, error)
 	// Stat is used to retrieve the stats about an object
@@ -30,6 +55,12 @@ type Manager interface {
 	// path really means the name of the link
 	// create is used to specify whether intermediary nodes should be generated
 	PatchLink(root, path, childHash string, create bool) (string, error)
+	// PatchRmLink is used to remove the named link from an object, returning the new object's hash
+	PatchRmLink(root, name string) (string, error)
+	// Patch is used to apply a sequence of operations to an object, returning the hash
+	// produced by each operation, the last being the final result. Operations are applied
+	// one at a time, so if one fails the hashes produced so far are returned with the error
+	Patch(root string, ops []PatchOp) ([]string, error)
 	// AppendData is used to modify the raw data within an object, to a max of 1MB
 	// Anything larger than 1MB will not be respected by the rest of the network
 	AppendData(root string, data interface{}) (string, error)
@@ -48,14 +79,46 @@ type Manager interface {
 	//
 	// returns the new pin path
 	PinUpdate(from, to string) (string, error)
-	// CheckPin checks whether or not a pin is present
+	// CheckPin checks whether or not a pin is present. A path is first
+	// resolved by the node, and the object it points to checked
 	CheckPin(hash string) (bool, error)
 	// Publish is used for fine grained control over IPNS record publishing
 	Publish(contentHash, keyName string, lifetime, ttl time.Duration, resolve bool) (*ipfsapi.PublishResponse, error)
-	// Resolve is used to resolve an IPNS hash
+	// KeyImport is used to import a private key into the keystore of the ipfs node
+	KeyImport(keyName string, pk ci.PrivKey) (*NodeKey, error)
+	// KeyList is used to list the keys held in the keystore of the ipfs node
+	KeyList() ([]NodeKey, error)
+	// KeyRemove is used to remove a key from the keystore of the ipfs node
+	KeyRemove(keyName string) error
+	// RoutingGet is used to retrieve the value stored in the routing system under key,
+	// such as the IPNS record for /ipns/<peer-id>
+	RoutingGet(key string) ([]byte, error)
+	// RoutingPut is used to store a value in the routing system under key,
+	// such as a signed IPNS record under /ipns/<peer-id>
+	RoutingPut(key string, value []byte) error
+	// GetIPNSRecord is used to retrieve and validate the IPNS record for a name,
+	// given as either a peer ID or an /ipns/ path. Records failing validation are
+	// not returned, and the error is an *IPNSValidationError. See UnmarshalIPNSRecord
+	// to inspect such records regardless
+	GetIPNSRecord(name string) (*IPNSRecord, error)
+	// Resolve is used to resolve an IPNS hash. /ipfs/ paths are validated before
+	// being sent to the node, while names are passed through as is
 	Resolve(hash string) (string, error)
-	// PubSubPublish is used to publish a a message to the given topic
+	// PubSubPublish is used to publish a a message to the given topic.
+	// Empty messages are allowed
 	PubSubPublish(topic string, data string) error
+	// PubSubPublishBytes is used to publish arbitrary binary data to the given topic,
+	// without it needing to be encoded first. The data may be empty, or contain newlines
+	PubSubPublishBytes(topic string, data []byte) error
+	// PubSubTopics is used to list the topics the node is subscribed to
+	PubSubTopics() ([]string, error)
+	// PubSubPeers is used to list the peers the node knows to be subscribed to topic.
+	// If topic is empty, peers subscribed to any topic are listed
+	PubSubPeers(topic string) ([]peer.ID, error)
+	// PubSubSubscribe is used to subscribe to a topic. Messages are delivered on the returned
+	// channel until the context is cancelled, at which point the channel is closed. If the
+	// connection to the node is lost, the subscription is automatically re-established
+	PubSubSubscribe(ctx context.Context, topic string) (<-chan Message, error)
 	// CustomRequest is used to make a custom request
 	CustomRequest(ctx context.Context, url, commad string, opts map[string]string, args ...string) (*ipfsapi.Response, error)
 	// GetLogs is used to return a logger for the IPFS HTTP API call log/tail
@@ -64,7 +127,39 @@ type Manager interface {
 	SwarmConnect(ctx context.Context, addrs ...string) error
 	// Refs is used to retrieve references of a hash
 	Refs(hash string, recursive, unique bool) ([]string, error)
+	// RefsStream is used to stream the refs of an object in the order the node emits them.
+	// The channel is closed once all refs have been sent, or the context is cancelled
+	RefsStream(ctx context.Context, hash string, opts RefsOpts) (<-chan RefResult, error)
+	// DagLinks is used to list the links of a single ipld object, in the order they appear.
+	// Raw blocks have no links, and sizes are only available for dag-pb objects given by cid,
+	// as the type of an object given by path is not known until the node resolves it
+	DagLinks(hash string) ([]DagLink, error)
 	// DeduplicatedSize will calculate the deduplicated size of an object.
 	// This is limited to UnixFS object types
 	DeduplicatedSize(hash string) (int, error)
+	// WithMFSRoot is used to scope mutable file system operations to root, creating it if
+	// needed. All paths given to the returned manager are relative to root, and can not
+	// escape it, so that each tenant can be given their own tree. Other operations are
+	// unaffected. Roots nest, so scoping an already scoped manager narrows it further
+	WithMFSRoot(root string) (Manager, error)
+	// FilesMkdir is used to create a mutable file system directory
+	FilesMkdir(dir string, parents bool) error
+	// FilesWrite is used to write the contents of r to a mutable file system file
+	FilesWrite(file string, r io.Reader, opts MFSWriteOpts) error
+	// FilesRead is used to read a mutable file system file, starting at offset.
+	// If count is greater than zero, at most count bytes are read
+	FilesRead(file string, offset, count int64) ([]byte, error)
+	// FilesLs is used to list a mutable file system directory
+	FilesLs(dir string) ([]MFSEntry, error)
+	// FilesStat is used to retrieve information about a mutable file system file or directory
+	FilesStat(file string) (*MFSStat, error)
+	// FilesMv is used to move a mutable file system file or directory
+	FilesMv(src, dst string) error
+	// FilesCp is used to copy a file or directory into the mutable file system. src
+	// may be a mutable file system path, or an /ipfs/ path to copy existing content
+	FilesCp(src, dst string) error
+	// FilesRm is used to remove a mutable file system file, or directory if recursive is set
+	FilesRm(file string, recursive bool) error
+	// FilesFlush is used to flush a mutable file system path to disk, returning its hash
+	FilesFlush(file string) (string, error)
 }
@@ -288,9 +288,6 @@ func TestPubSub_Failure(t *testing.T) {
 	if err = im.PubSubPublish("", "data"); err == nil {
 		t.Fatal("failed to validate topic")
 	}
-	if err = im.PubSubPublish("topic", ""); err == nil {
-		t.Fatal("failed to validate data")
-	}
 }
 
 func TestPatchLink(t *testing.T) {
@@ -0,0 +1,573 @@
+// Package rtfstest provides an in-memory rtfs.Manager for use in tests
+package rtfstest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ipfsapi "github.com/RTradeLtd/go-ipfs-api/v3"
+	"github.com/RTradeLtd/rtfs/v2"
+	"github.com/ipfs/go-cid"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// ErrUnsupported is returned by calls the fake node does not implement
+var ErrUnsupported = errors.New("rtfstest: not supported by the fake node")
+
+var _ rtfs.Manager = (*Node)(nil)
+
+// Node is an in-memory stand-in for an ipfs node. Calls it does not
+// implement return ErrUnsupported, so tests fail rather than panic
+type Node struct {
+	mux      sync.Mutex
+	calls    map[string][]string
+	failures map[string]error
+	keys     map[string]string
+	routing  map[string][]byte
+	names    map[string]string
+	subs     map[string][]*subscription
+	links    map[string][]rtfs.DagLink
+	objects  map[string][]byte
+}
+
+// subscription is a pubsub subscription, closed once its context is done
+type subscription struct {
+	ctx      context.Context
+	mux      sync.Mutex
+	closed   bool
+	messages chan rtfs.Message
+}
+
+// deliver is used to send msg to the subscriber, unless it has been closed
+func (s *subscription) deliver(msg rtfs.Message) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.messages <- msg:
+	case <-s.ctx.Done():
+	}
+}
+
+// NewNode is used to instantiate an empty Node
+func NewNode() *Node {
+	return &Node{
+		calls:    make(map[string][]string),
+		failures: make(map[string]error),
+		keys:     make(map[string]string),
+		routing:  make(map[string][]byte),
+		names:    make(map[string]string),
+		subs:     make(map[string][]*subscription),
+		links:    make(map[string][]rtfs.DagLink),
+		objects:  make(map[string][]byte),
+	}
+}
+
+// Calls is used to return the first string argument of every call made to the
+// named method, in order. Calls without a string argument are recorded as ""
+func (n *Node) Calls(method string) []string {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	return append([]string(nil), n.calls[method]...)
+}
+
+// Fail is used to make every following call to the named method return err.
+// A nil err restores the normal behaviour
+func (n *Node) Fail(method string, err error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.failures[method] = err
+}
+
+// SetKey is used to place a key with the given identity in the node keystore,
+// as if it had been created on the node
+func (n *Node) SetKey(keyName, id string) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.keys[keyName] = id
+}
+
+// SetName is used to make Resolve return value for name, as if the node had the
+// name cached. It does not affect GetIPNSRecord, which uses the routing records
+func (n *Node) SetName(name, value string) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.names[name] = value
+}
+
+// SetObject is used to store data under hash, such as content the node would
+// hold already. Data stored through the node is hashed, but with its raw bytes
+// rather than as unixfs, so hashes differ from those of a real node
+func (n *Node) SetObject(hash string, data []byte) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.objects[hash] = append([]byte(nil), data...)
+}
+
+// put is used to store data under a sha2-256 cid, and must be called with the lock held
+func (n *Node) put(data []byte, version, codec uint64) (string, error) {
+	hash, err := mh.Sum(data, mh.SHA2_256, -1)
+	if err != nil {
+		return "", err
+	}
+	c := cid.NewCidV1(codec, hash)
+	if version == 0 {
+		c = cid.NewCidV0(hash)
+	}
+	n.objects[c.String()] = append([]byte(nil), data...)
+	return c.String(), nil
+}
+
+// object is used to retrieve stored data, and must be called with the lock held
+func (n *Node) object(hash string) ([]byte, error) {
+	data, ok := n.objects[strings.TrimPrefix(hash, "/ipfs/")]
+	if !ok {
+		return nil, fmt.Errorf("object '%s' not found", hash)
+	}
+	return data, nil
+}
+
+// SetLinks is used to add an object with the given links to the dag
+func (n *Node) SetLinks(hash string, links []rtfs.DagLink) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.links[hash] = links
+}
+
+// record is used to log a call, returning the failure set for the method.
+// It must be called with the lock held
+func (n *Node) record(method, arg string) error {
+	n.calls[method] = append(n.calls[method], arg)
+	return n.failures[method]
+}
+
+// NodeAddress returns the address of the fake node
+func (n *Node) NodeAddress() string { return "rtfstest" }
+
+// Add is used to store the content of r, returning its cid. Options are ignored
+func (n *Node) Add(r io.Reader, options ...ipfsapi.AddOpts) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("Add", ""); err != nil {
+		return "", err
+	}
+	return n.put(data, 0, cid.DagProtobuf)
+}
+
+// AddDir is not supported
+func (n *Node) AddDir(dir string) (string, error) { return "", ErrUnsupported }
+
+// AddDirWithOptions is not supported
+func (n *Node) AddDirWithOptions(dir string, opts rtfs.AddDirOpts) (string, error) {
+	return "", ErrUnsupported
+}
+
+// AddReaders is not supported
+func (n *Node) AddReaders(name string, entries []rtfs.AddEntry, opts rtfs.AddDirOpts) (string, error) {
+	return "", ErrUnsupported
+}
+
+// AddFS is not supported
+func (n *Node) AddFS(name string, fsys fs.FS, opts rtfs.AddDirOpts) (string, error) {
+	return "", ErrUnsupported
+}
+
+// DagPut is not supported
+func (n *Node) DagPut(data interface{}, encoding, kind string) (string, error) {
+	return "", ErrUnsupported
+}
+
+// DagGet is not supported
+func (n *Node) DagGet(cid string, out interface{}) error { return ErrUnsupported }
+
+// DagPutWithOptions is used to store data under a dag-cbor cid, as a node does by
+// default, though it is stored encoded as json. Options are ignored
+func (n *Node) DagPutWithOptions(data interface{}, opts rtfs.DagPutOpts) (string, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("DagPutWithOptions", ""); err != nil {
+		return "", err
+	}
+	return n.put(encoded, 1, cid.DagCBOR)
+}
+
+// DagGetPath is used to decode an object stored with DagPutWithOptions into out.
+// Paths within objects are not supported
+func (n *Node) DagGetPath(p string, out interface{}) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("DagGetPath", p); err != nil {
+		return err
+	}
+	data, err := n.object(p)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// BlockPut is used to store a block. format is the name of its codec,
+// or "v0" to store it as dag-pb under a version 0 cid
+func (n *Node) BlockPut(data []byte, format string) (string, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("BlockPut", format); err != nil {
+		return "", err
+	}
+	if format == "v0" {
+		return n.put(data, 0, cid.DagProtobuf)
+	}
+	codec, ok := cid.Codecs[format]
+	if !ok {
+		return "", fmt.Errorf("unknown format '%s'", format)
+	}
+	return n.put(data, 1, codec)
+}
+
+// Cat is used to retrieve stored data
+func (n *Node) Cat(hash string) ([]byte, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("Cat", hash); err != nil {
+		return nil, err
+	}
+	data, err := n.object(hash)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Stat is used to retrieve the size of a stored object
+func (n *Node) Stat(hash string) (*ipfsapi.ObjectStats, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("Stat", hash); err != nil {
+		return nil, err
+	}
+	data, err := n.object(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &ipfsapi.ObjectStats{
+		Hash:           strings.TrimPrefix(hash, "/ipfs/"),
+		DataSize:       len(data),
+		CumulativeSize: len(data),
+	}, nil
+}
+
+// PatchLink is not supported
+func (n *Node) PatchLink(root, path, childHash string, create bool) (string, error) {
+	return "", ErrUnsupported
+}
+
+// PatchRmLink is not supported
+func (n *Node) PatchRmLink(root, name string) (string, error) { return "", ErrUnsupported }
+
+// Patch is not supported
+func (n *Node) Patch(root string, ops []rtfs.PatchOp) ([]string, error) {
+	return nil, ErrUnsupported
+}
+
+// AppendData is not supported
+func (n *Node) AppendData(root string, data interface{}) (string, error) {
+	return "", ErrUnsupported
+}
+
+// SetData is not supported
+func (n *Node) SetData(root string, data interface{}) (string, error) {
+	return "", ErrUnsupported
+}
+
+// NewObject is not supported
+func (n *Node) NewObject(template string) (string, error) { return "", ErrUnsupported }
+
+// Pin is not supported
+func (n *Node) Pin(hash string) error { return ErrUnsupported }
+
+// PinUpdate is not supported
+func (n *Node) PinUpdate(from, to string) (string, error) { return "", ErrUnsupported }
+
+// CheckPin is not supported
+func (n *Node) CheckPin(hash string) (bool, error) { return false, ErrUnsupported }
+
+// Publish is not supported
+func (n *Node) Publish(contentHash, keyName string, lifetime, ttl time.Duration, resolve bool) (*ipfsapi.PublishResponse, error) {
+	return nil, ErrUnsupported
+}
+
+// KeyImport is used to add a key to the node keystore, failing if the name is taken
+func (n *Node) KeyImport(keyName string, pk ci.PrivKey) (*rtfs.NodeKey, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("KeyImport", keyName); err != nil {
+		return nil, err
+	}
+	if _, ok := n.keys[keyName]; ok {
+		return nil, fmt.Errorf("key with name '%s' already exists", keyName)
+	}
+	id, err := peer.IDFromPrivateKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	n.keys[keyName] = id.Pretty()
+	return &rtfs.NodeKey{Name: keyName, ID: id.Pretty()}, nil
+}
+
+// KeyList is used to list the keys in the node keystore
+func (n *Node) KeyList() ([]rtfs.NodeKey, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("KeyList", ""); err != nil {
+		return nil, err
+	}
+	keys := make([]rtfs.NodeKey, 0, len(n.keys))
+	for name, id := range n.keys {
+		keys = append(keys, rtfs.NodeKey{Name: name, ID: id})
+	}
+	return keys, nil
+}
+
+// KeyRemove is used to remove a key from the node keystore
+func (n *Node) KeyRemove(keyName string) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("KeyRemove", keyName); err != nil {
+		return err
+	}
+	if _, ok := n.keys[keyName]; !ok {
+		return fmt.Errorf("no key named %s was found", keyName)
+	}
+	delete(n.keys, keyName)
+	return nil
+}
+
+// RoutingGet is used to retrieve the value stored under key, returning
+// rtfs.ErrRoutingNotFound if there is none
+func (n *Node) RoutingGet(key string) ([]byte, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("RoutingGet", key); err != nil {
+		return nil, err
+	}
+	value, ok := n.routing[key]
+	if !ok {
+		return nil, rtfs.ErrRoutingNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// RoutingPut is used to store value under key, replacing any previous value
+func (n *Node) RoutingPut(key string, value []byte) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("RoutingPut", key); err != nil {
+		return err
+	}
+	n.routing[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// GetIPNSRecord is used to retrieve and validate the record stored in
+// the routing system for name, as rtfs.IpfsManager does
+func (n *Node) GetIPNSRecord(name string) (*rtfs.IPNSRecord, error) {
+	n.mux.Lock()
+	err := n.record("GetIPNSRecord", name)
+	n.mux.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	id, err := peer.Decode(strings.TrimPrefix(name, "/ipns/"))
+	if err != nil {
+		return nil, err
+	}
+	data, err := n.RoutingGet("/ipns/" + id.Pretty())
+	if err != nil {
+		return nil, err
+	}
+	record, err := rtfs.UnmarshalIPNSRecord(data)
+	if err != nil {
+		return nil, &rtfs.IPNSValidationError{Name: name, Err: err}
+	}
+	if err := record.Validate(id); err != nil {
+		return nil, &rtfs.IPNSValidationError{Name: name, Err: err}
+	}
+	return record, nil
+}
+
+// Resolve is used to resolve a name set with SetName
+func (n *Node) Resolve(hash string) (string, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("Resolve", hash); err != nil {
+		return "", err
+	}
+	value, ok := n.names[hash]
+	if !ok {
+		return "", fmt.Errorf("could not resolve name '%s'", hash)
+	}
+	return value, nil
+}
+
+// PubSubPublish is used to publish a message to every subscriber of topic
+func (n *Node) PubSubPublish(topic string, data string) error {
+	return n.PubSubPublishBytes(topic, []byte(data))
+}
+
+// PubSubPublishBytes is used to publish a message to every subscriber of topic.
+// Delivery blocks until each subscriber has received the message
+func (n *Node) PubSubPublishBytes(topic string, data []byte) error {
+	n.mux.Lock()
+	err := n.record("PubSubPublishBytes", topic)
+	subs := append([]*subscription(nil), n.subs[topic]...)
+	n.mux.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		sub.deliver(rtfs.Message{Topic: topic, Data: append([]byte(nil), data...)})
+	}
+	return nil
+}
+
+// PubSubTopics is used to list the topics with at least one subscriber
+func (n *Node) PubSubTopics() ([]string, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("PubSubTopics", ""); err != nil {
+		return nil, err
+	}
+	topics := make([]string, 0, len(n.subs))
+	for topic, subs := range n.subs {
+		if len(subs) > 0 {
+			topics = append(topics, topic)
+		}
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+// PubSubPeers is not supported
+func (n *Node) PubSubPeers(topic string) ([]peer.ID, error) { return nil, ErrUnsupported }
+
+// PubSubSubscribe is used to subscribe to topic until the context is cancelled
+func (n *Node) PubSubSubscribe(ctx context.Context, topic string) (<-chan rtfs.Message, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("PubSubSubscribe", topic); err != nil {
+		return nil, err
+	}
+	sub := &subscription{ctx: ctx, messages: make(chan rtfs.Message, 16)}
+	n.subs[topic] = append(n.subs[topic], sub)
+	go func() {
+		<-ctx.Done()
+		n.mux.Lock()
+		for i, s := range n.subs[topic] {
+			if s == sub {
+				n.subs[topic] = append(n.subs[topic][:i], n.subs[topic][i+1:]...)
+				break
+			}
+		}
+		n.mux.Unlock()
+		sub.mux.Lock()
+		sub.closed = true
+		close(sub.messages)
+		sub.mux.Unlock()
+	}()
+	return sub.messages, nil
+}
+
+// CustomRequest is not supported
+func (n *Node) CustomRequest(ctx context.Context, url, commad string, opts map[string]string, args ...string) (*ipfsapi.Response, error) {
+	return nil, ErrUnsupported
+}
+
+// GetLogs is not supported
+func (n *Node) GetLogs(ctx context.Context) (ipfsapi.Logger, error) {
+	return ipfsapi.Logger{}, ErrUnsupported
+}
+
+// SwarmConnect is not supported
+func (n *Node) SwarmConnect(ctx context.Context, addrs ...string) error { return ErrUnsupported }
+
+// Refs is not supported
+func (n *Node) Refs(hash string, recursive, unique bool) ([]string, error) {
+	return nil, ErrUnsupported
+}
+
+// RefsStream is not supported
+func (n *Node) RefsStream(ctx context.Context, hash string, opts rtfs.RefsOpts) (<-chan rtfs.RefResult, error) {
+	return nil, ErrUnsupported
+}
+
+// DagLinks is used to list the links of an object added with SetLinks
+func (n *Node) DagLinks(hash string) ([]rtfs.DagLink, error) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if err := n.record("DagLinks", hash); err != nil {
+		return nil, err
+	}
+	links, ok := n.links[hash]
+	if !ok {
+		return nil, fmt.Errorf("object '%s' not found", hash)
+	}
+	return append([]rtfs.DagLink(nil), links...), nil
+}
+
+// DeduplicatedSize is not supported
+func (n *Node) DeduplicatedSize(hash string) (int, error) { return 0, ErrUnsupported }
+
+// WithMFSRoot is not supported
+func (n *Node) WithMFSRoot(root string) (rtfs.Manager, error) { return nil, ErrUnsupported }
+
+// FilesMkdir is not supported
+func (n *Node) FilesMkdir(dir string, parents bool) error { return ErrUnsupported }
+
+// FilesWrite is not supported
+func (n *Node) FilesWrite(file string, r io.Reader, opts rtfs.MFSWriteOpts) error {
+	return ErrUnsupported
+}
+
+// FilesRead is not supported
+func (n *Node) FilesRead(file string, offset, count int64) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// FilesLs is not supported
+func (n *Node) FilesLs(dir string) ([]rtfs.MFSEntry, error) { return nil, ErrUnsupported }
+
+// FilesStat is not supported
+func (n *Node) FilesStat(file string) (*rtfs.MFSStat, error) { return nil, ErrUnsupported }
+
+// FilesMv is not supported
+func (n *Node) FilesMv(src, dst string) error { return ErrUnsupported }
+
+// FilesCp is not supported
+func (n *Node) FilesCp(src, dst string) error { return ErrUnsupported }
+
+// FilesRm is not supported
+func (n *Node) FilesRm(file string, recursive bool) error { return ErrUnsupported }
+
+// FilesFlush is not supported
+func (n *Node) FilesFlush(file string) (string, error) { return "", ErrUnsupported }
@@ -0,0 +1,234 @@
+package rtfs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	mnemonics "github.com/RTradeLtd/entropy-mnemonics"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+// shamir secret sharing over GF(2^8). Every byte of the secret is shared with
+// its own random polynomial, and each share is the polynomial evaluations
+// followed by a single byte identifying the x coordinate the share was taken at.
+
+const (
+	// MinShareThreshold is the smallest number of shares that may be required
+	// to reconstruct a key
+	MinShareThreshold = 2
+	// MaxShares is the largest number of shares a key may be split into
+	MaxShares = 255
+)
+
+// SplitKey is used to split the named key into the given number of shares,
+// any threshold of which can be used to reconstruct the key
+func (km *KeystoreManager) SplitKey(keyName string, shares, threshold int) ([][]byte, error) {
+	var parts [][]byte
+	if err := km.exportKey(keyName, func(pkBytes []byte) (err error) {
+		parts, err = splitSecret(pkBytes, shares, threshold)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// ExportKeySharesAsMnemonics is used to split the named key into shares, returning
+// each share as a human-readable mnemonic phrase
+func (km *KeystoreManager) ExportKeySharesAsMnemonics(keyName string, shares, threshold int) ([]string, error) {
+	parts, err := km.SplitKey(keyName, shares, threshold)
+	if err != nil {
+		return nil, err
+	}
+	phrases := make([]string, 0, len(parts))
+	for _, part := range parts {
+		phrase, err := mnemonics.ToPhrase(part, mnemonics.English)
+		if err != nil {
+			return nil, err
+		}
+		phrases = append(phrases, phrase.String())
+	}
+	return phrases, nil
+}
+
+// ExportKeySharesAsText is used to split the named key into shares, returning
+// each share as a hex encoded text blob
+func (km *KeystoreManager) ExportKeySharesAsText(keyName string, shares, threshold int) ([]string, error) {
+	parts, err := km.SplitKey(keyName, shares, threshold)
+	if err != nil {
+		return nil, err
+	}
+	blobs := make([]string, 0, len(parts))
+	for _, part := range parts {
+		blobs = append(blobs, hex.EncodeToString(part))
+	}
+	return blobs, nil
+}
+
+// RecoverKeyFromShares is used to reconstruct a key from its shares,
+// and save it under the specified name
+func (km *KeystoreManager) RecoverKeyFromShares(keyName string, shares [][]byte) (ci.PrivKey, error) {
+	pk, err := CombineKeyShares(shares)
+	if err != nil {
+		return nil, err
+	}
+	if err := km.SavePrivateKey(keyName, pk); err != nil {
+		return nil, err
+	}
+	return pk, nil
+}
+
+// RecoverKeyFromMnemonicShares is used to reconstruct a key from shares exported
+// with ExportKeySharesAsMnemonics, and save it under the specified name
+func (km *KeystoreManager) RecoverKeyFromMnemonicShares(keyName string, phrases []string) (ci.PrivKey, error) {
+	shares := make([][]byte, 0, len(phrases))
+	for _, phrase := range phrases {
+		share, err := mnemonics.FromString(phrase, mnemonics.English)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return km.RecoverKeyFromShares(keyName, shares)
+}
+
+// RecoverKeyFromTextShares is used to reconstruct a key from shares exported
+// with ExportKeySharesAsText, and save it under the specified name
+func (km *KeystoreManager) RecoverKeyFromTextShares(keyName string, blobs []string) (ci.PrivKey, error) {
+	shares := make([][]byte, 0, len(blobs))
+	for _, blob := range blobs {
+		share, err := hex.DecodeString(blob)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return km.RecoverKeyFromShares(keyName, shares)
+}
+
+// CombineKeyShares takes a threshold of key shares, and converts them to a private key
+func CombineKeyShares(shares [][]byte) (ci.PrivKey, error) {
+	pkBytes, err := combineShares(shares)
+	if err != nil {
+		return nil, err
+	}
+	return ci.UnmarshalPrivateKey(pkBytes)
+}
+
+// splitSecret splits secret into the given number of shares
+func splitSecret(secret []byte, shares, threshold int) ([][]byte, error) {
+	switch {
+	case len(secret) == 0:
+		return nil, errors.New("secret is empty")
+	case threshold < MinShareThreshold:
+		return nil, fmt.Errorf("threshold must be at least %v", MinShareThreshold)
+	case shares < threshold:
+		return nil, errors.New("shares must be greater than or equal to threshold")
+	case shares > MaxShares:
+		return nil, fmt.Errorf("shares must be at most %v", MaxShares)
+	}
+	out := make([][]byte, shares)
+	for i := range out {
+		out[i] = make([]byte, len(secret)+1)
+		// x coordinates start at 1, since 0 holds the secret
+		out[i][len(secret)] = uint8(i + 1)
+	}
+	coefficients := make([]byte, threshold)
+	for idx, b := range secret {
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		coefficients[0] = b
+		for i := range out {
+			out[i][idx] = gfEvaluate(coefficients, out[i][len(secret)])
+		}
+	}
+	return out, nil
+}
+
+// combineShares reconstructs the secret held in shares
+func combineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < MinShareThreshold {
+		return nil, fmt.Errorf("at least %v shares are required", MinShareThreshold)
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, errors.New("shares are too short")
+	}
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool, len(shares))
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, errors.New("shares must all be the same length")
+		}
+		x := share[size-1]
+		if x == 0 || seen[x] {
+			return nil, errors.New("shares contain an invalid or duplicate identifier")
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+	secret := make([]byte, size-1)
+	ys := make([]byte, len(shares))
+	for idx := range secret {
+		for i, share := range shares {
+			ys[i] = share[idx]
+		}
+		secret[idx] = gfInterpolateZero(xs, ys)
+	}
+	return secret, nil
+}
+
+// gfEvaluate evaluates the polynomial with the given coefficients at x
+func gfEvaluate(coefficients []byte, x byte) byte {
+	var out byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		out = gfMul(out, x) ^ coefficients[i]
+	}
+	return out
+}
+
+// gfInterpolateZero uses lagrange interpolation to find the value at x = 0
+// of the polynomial passing through the given points
+func gfInterpolateZero(xs, ys []byte) byte {
+	var out byte
+	for i := range xs {
+		basis := byte(1)
+		for j := range xs {
+			if i == j {
+				continue
+			}
+			basis = gfMul(basis, gfMul(xs[j], gfInv(xs[i]^xs[j])))
+		}
+		out ^= gfMul(ys[i], basis)
+	}
+	return out
+}
+
+// gfMul multiplies two elements of GF(2^8), reducing by x^8 + x^4 + x^3 + x + 1
+func gfMul(a, b byte) byte {
+	var out byte
+	for b > 0 {
+		if b&1 == 1 {
+			out ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return out
+}
+
+// gfInv returns the multiplicative inverse of a, which is a^254
+func gfInv(a byte) byte {
+	out := a
+	for i := 0; i < 253; i++ {
+		out = gfMul(out, a)
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package rtfs_test
+
+import (
+	"testing"
+
+	"github.com/RTradeLtd/krab/v4"
+	"github.com/RTradeLtd/rtfs/v2"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+func newTestKeystoreManager(t *testing.T) *rtfs.KeystoreManager {
+	kb, err := krab.NewKeystore(dssync.MutexWrap(datastore.NewMapDatastore()), "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	km, err := rtfs.NewKeystoreManager(kb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return km
+}
+
+func TestKeyShares(t *testing.T) {
+	km := newTestKeystoreManager(t)
+	pk, err := km.CreateAndSaveKey("original", ci.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		shares    int
+		threshold int
+		wantErr   bool
+	}{
+		{"3-of-5", 5, 3, false},
+		{"2-of-2", 2, 2, false},
+		{"Threshold-Too-Low", 5, 1, true},
+		{"Threshold-Above-Shares", 2, 3, true},
+		{"Too-Many-Shares", 256, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares, err := km.SplitKey("original", tt.shares, tt.threshold)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitKey() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(shares) != tt.shares {
+				t.Fatal("bad share count")
+			}
+			recovered, err := km.RecoverKeyFromShares(tt.name, shares[len(shares)-tt.threshold:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !recovered.Equals(pk) {
+				t.Fatal("recovered key does not match original")
+			}
+			if tt.threshold > 2 {
+				if recovered, err := rtfs.CombineKeyShares(shares[:tt.threshold-1]); err == nil && recovered.Equals(pk) {
+					t.Fatal("recovered key from fewer shares than the threshold")
+				}
+			}
+		})
+	}
+}
+
+func TestKeyShares_Export(t *testing.T) {
+	km := newTestKeystoreManager(t)
+	pk, err := km.CreateAndSaveKey("original", ci.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	phrases, err := km.ExportKeySharesAsMnemonics("original", 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := km.RecoverKeyFromMnemonicShares("mnemonic", phrases[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !recovered.Equals(pk) {
+		t.Fatal("recovered key does not match original")
+	}
+	blobs, err := km.ExportKeySharesAsText("original", 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered, err = km.RecoverKeyFromTextShares("text", []string{blobs[0], blobs[2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !recovered.Equals(pk) {
+		t.Fatal("recovered key does not match original")
+	}
+	if _, err := km.RecoverKeyFromTextShares("duplicate", []string{blobs[0], blobs[0]}); err == nil {
+		t.Fatal("expected error recovering from duplicate shares")
+	}
+}
@@ -0,0 +1,593 @@
+package rtfs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ipfs/go-cid"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// keyEnvelopeVersion is the version of the key envelope format
+const keyEnvelopeVersion = 1
+
+// keyWrapInfo binds wrapped data keys to their purpose
+const keyWrapInfo = "rtfs-key-wrap"
+
+// keyEnvelopeSignaturePrefix is prepended to all signed key envelope statements so that
+// an envelope signature can never be confused with a signature over arbitrary data
+const keyEnvelopeSignaturePrefix = "rtfs-key-envelope"
+
+// KeyEnvelope holds the data key of an encrypted object, wrapped for each recipient
+// allowed to read it. It is stored as an ipld object linking to the encrypted
+// content, so pinning an envelope pins the content with it. Envelopes are signed
+// by the key which shared the content, and only that key can change access
+type KeyEnvelope struct {
+	Version int     `json:"version"`
+	Content cid.Cid `json:"content"`
+	// Recipients holds the data key wrapped for each recipient
+	Recipients []KeyRecipient `json:"recipients"`
+	// Owner is the peer ID of the key which shared the content
+	Owner     string `json:"owner"`
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+}
+
+// KeyRecipient is the data key of an object wrapped for a single public key
+type KeyRecipient struct {
+	// ID is the peer ID of the recipient's public key
+	ID string `json:"id"`
+	// EphemeralKey is the ephemeral public key used to wrap the data key for
+	// elliptic curve recipients, and is empty for rsa recipients
+	EphemeralKey []byte `json:"ephemeral_key,omitempty"`
+	WrappedKey   []byte `json:"wrapped_key"`
+}
+
+// recipient returns the entry for the peer id, if present
+func (ke *KeyEnvelope) recipient(id string) (KeyRecipient, bool) {
+	for _, r := range ke.Recipients {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return KeyRecipient{}, false
+}
+
+// AddShared is used to encrypt r with a new data key, add it to ipfs, and store a key
+// envelope granting the named key and recipients access to it. Recipients may be given
+// as peer IDs with an embedded public key, or base64 encoded public keys. The hash of
+// the envelope is returned, and is what should be shared in place of the content hash
+func (km *KeystoreManager) AddShared(keyName string, r io.Reader, opts EncryptOpts, recipients []string, im Manager) (string, error) {
+	owner, err := km.GetPrivateKeyByName(keyName)
+	if err != nil {
+		return "", err
+	}
+	pubs, err := parseRecipients(recipients)
+	if err != nil {
+		return "", err
+	}
+	dataKey := make([]byte, encryptionKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	encrypted, err := NewEncryptReader(r, EncryptionKey{kdf: kdfNone, secret: dataKey}, opts)
+	if err != nil {
+		return "", err
+	}
+	hash, err := im.Add(encrypted)
+	if err != nil {
+		return "", err
+	}
+	content, err := cid.Decode(hash)
+	if err != nil {
+		return "", err
+	}
+	env := &KeyEnvelope{Version: keyEnvelopeVersion, Content: content}
+	if err := env.grant(dataKey, append([]ci.PubKey{owner.GetPublic()}, pubs...)); err != nil {
+		return "", err
+	}
+	if err := env.sign(owner); err != nil {
+		return "", err
+	}
+	return PutKeyEnvelope(env, im)
+}
+
+// CatShared is used to retrieve and decrypt content shared with the named key by owner,
+// given as a peer ID or public key. Anyone can sign an envelope wrapping their own data
+// key for a recipient, so envelopes not signed by owner are rejected
+func (km *KeystoreManager) CatShared(keyName, envelopeHash, owner string, im Manager) ([]byte, error) {
+	ownerID, err := recipientID(owner)
+	if err != nil {
+		return nil, fmt.Errorf("invalid owner '%s': %s", owner, err.Error())
+	}
+	env, err := GetKeyEnvelope(envelopeHash, im)
+	if err != nil {
+		return nil, err
+	}
+	if env.Owner != ownerID {
+		return nil, fmt.Errorf("envelope is owned by '%s', not '%s'", env.Owner, ownerID)
+	}
+	pk, err := km.GetPrivateKeyByName(keyName)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := env.unwrap(pk)
+	if err != nil {
+		return nil, err
+	}
+	data, err := im.Cat(env.Content.String())
+	if err != nil {
+		return nil, err
+	}
+	return Decrypt(data, EncryptionKey{kdf: kdfNone, secret: dataKey})
+}
+
+// GrantAccess is used to give recipients access to shared content. The named key must
+// be the owner of the envelope, and is used to recover the data key. The content is not
+// re-encrypted. A new envelope signed by the owner is stored, and its hash returned
+func (km *KeystoreManager) GrantAccess(keyName, envelopeHash string, recipients []string, im Manager) (string, error) {
+	env, owner, err := km.ownedKeyEnvelope(keyName, envelopeHash, im)
+	if err != nil {
+		return "", err
+	}
+	pubs, err := parseRecipients(recipients)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := env.unwrap(owner)
+	if err != nil {
+		return "", err
+	}
+	if err := env.grant(dataKey, pubs); err != nil {
+		return "", err
+	}
+	if err := env.sign(owner); err != nil {
+		return "", err
+	}
+	return PutKeyEnvelope(env, im)
+}
+
+// RevokeAccess is used to remove recipients from shared content. The named key must be
+// the owner of the envelope, and can not be revoked. A new envelope signed by the owner
+// is stored, and its hash returned. The content is not re-encrypted, so revoked recipients
+// can no longer read it through the new envelope, but can still read it with any data
+// key or earlier envelope they have kept. Content which must be kept from them should
+// be shared again with AddShared
+func (km *KeystoreManager) RevokeAccess(keyName, envelopeHash string, recipients []string, im Manager) (string, error) {
+	env, owner, err := km.ownedKeyEnvelope(keyName, envelopeHash, im)
+	if err != nil {
+		return "", err
+	}
+	revoked := make(map[string]bool, len(recipients))
+	for _, recipient := range recipients {
+		id, err := recipientID(recipient)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := env.recipient(id); !ok {
+			return "", fmt.Errorf("'%s' is not a recipient", recipient)
+		} else if id == env.Owner {
+			return "", errors.New("can not revoke access from the owner")
+		}
+		revoked[id] = true
+	}
+	kept := make([]KeyRecipient, 0, len(env.Recipients))
+	for _, r := range env.Recipients {
+		if !revoked[r.ID] {
+			kept = append(kept, r)
+		}
+	}
+	env.Recipients = kept
+	if err := env.sign(owner); err != nil {
+		return "", err
+	}
+	return PutKeyEnvelope(env, im)
+}
+
+// PutKeyEnvelope is used to store a signed key envelope as an ipld object
+func PutKeyEnvelope(env *KeyEnvelope, im Manager) (string, error) {
+	if !env.Content.Defined() {
+		return "", errors.New("key envelope has no content")
+	}
+	if len(env.Recipients) == 0 {
+		return "", errors.New("key envelope has no recipients")
+	}
+	if err := env.Verify(); err != nil {
+		return "", err
+	}
+	return im.DagPutWithOptions(env, DagPutOpts{Pin: true})
+}
+
+// GetKeyEnvelope is used to retrieve and verify a key envelope stored with PutKeyEnvelope
+func GetKeyEnvelope(hash string, im Manager) (*KeyEnvelope, error) {
+	var env KeyEnvelope
+	if err := im.DagGetPath(hash, &env); err != nil {
+		return nil, err
+	}
+	if env.Version != keyEnvelopeVersion {
+		return nil, fmt.Errorf("unsupported key envelope version %v", env.Version)
+	}
+	if !env.Content.Defined() {
+		return nil, errors.New("key envelope has no content")
+	}
+	if err := env.Verify(); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+// ownedKeyEnvelope is used to retrieve a key envelope along with the named key,
+// checking that the key is the owner of the envelope
+func (km *KeystoreManager) ownedKeyEnvelope(keyName, envelopeHash string, im Manager) (*KeyEnvelope, ci.PrivKey, error) {
+	env, err := GetKeyEnvelope(envelopeHash, im)
+	if err != nil {
+		return nil, nil, err
+	}
+	pk, err := km.GetPrivateKeyByName(keyName)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := peer.IDFromPrivateKey(pk)
+	if err != nil {
+		return nil, nil, err
+	}
+	if id.Pretty() != env.Owner {
+		return nil, nil, fmt.Errorf("key '%s' is not the owner of the envelope", keyName)
+	}
+	return env, pk, nil
+}
+
+// sign is used to sign the envelope with the owner's key
+func (ke *KeyEnvelope) sign(owner ci.PrivKey) error {
+	id, err := peer.IDFromPrivateKey(owner)
+	if err != nil {
+		return err
+	}
+	pubBytes, err := owner.GetPublic().Bytes()
+	if err != nil {
+		return err
+	}
+	ke.Owner = id.Pretty()
+	ke.PublicKey = pubBytes
+	statement, err := ke.statement()
+	if err != nil {
+		return err
+	}
+	ke.Signature, err = owner.Sign(statement)
+	return err
+}
+
+// Verify is used to check that the envelope is signed, and
+// that the signature was produced by the key belonging to the owner
+func (ke *KeyEnvelope) Verify() error {
+	if len(ke.Signature) == 0 {
+		return errors.New("key envelope is not signed")
+	}
+	pub, err := ci.UnmarshalPublicKey(ke.PublicKey)
+	if err != nil {
+		return err
+	}
+	id, err := peer.Decode(ke.Owner)
+	if err != nil {
+		return err
+	}
+	if !id.MatchesPublicKey(pub) {
+		return errors.New("public key does not match owner")
+	}
+	statement, err := ke.statement()
+	if err != nil {
+		return err
+	}
+	valid, err := pub.Verify(statement, ke.Signature)
+	if err != nil {
+		return err
+	} else if !valid {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// statement returns the bytes that are signed, which cover every field but the signature
+func (ke *KeyEnvelope) statement() ([]byte, error) {
+	recipients := make([]interface{}, 0, len(ke.Recipients))
+	for _, r := range ke.Recipients {
+		recipients = append(recipients, map[string]interface{}{
+			"id":            r.ID,
+			"ephemeral_key": r.EphemeralKey,
+			"wrapped_key":   r.WrappedKey,
+		})
+	}
+	encoded, err := cborEncode(map[string]interface{}{
+		"version":    ke.Version,
+		"content":    ke.Content.Bytes(),
+		"recipients": recipients,
+		"owner":      ke.Owner,
+		"public_key": ke.PublicKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(keyEnvelopeSignaturePrefix+"\n"), encoded...), nil
+}
+
+// grant wraps the data key for each public key not already a recipient
+func (ke *KeyEnvelope) grant(dataKey []byte, pubs []ci.PubKey) error {
+	for _, pub := range pubs {
+		id, err := peer.IDFromPublicKey(pub)
+		if err != nil {
+			return err
+		}
+		if _, ok := ke.recipient(id.Pretty()); ok {
+			continue
+		}
+		recipient, err := wrapDataKey(pub, dataKey)
+		if err != nil {
+			return fmt.Errorf("failed to wrap key for '%s': %s", id.Pretty(), err.Error())
+		}
+		recipient.ID = id.Pretty()
+		ke.Recipients = append(ke.Recipients, recipient)
+	}
+	return nil
+}
+
+// unwrap recovers the data key of the envelope with a recipient's private key
+func (ke *KeyEnvelope) unwrap(pk ci.PrivKey) ([]byte, error) {
+	id, err := peer.IDFromPrivateKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	recipient, ok := ke.recipient(id.Pretty())
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a recipient", id.Pretty())
+	}
+	return unwrapDataKey(pk, recipient)
+}
+
+func parseRecipients(recipients []string) ([]ci.PubKey, error) {
+	pubs := make([]ci.PubKey, 0, len(recipients))
+	for _, recipient := range recipients {
+		pub, err := ParsePublicKey(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient '%s': %s", recipient, err.Error())
+		}
+		pubs = append(pubs, pub)
+	}
+	return pubs, nil
+}
+
+// recipientID returns the peer id of a recipient given as a peer id or public key.
+// Peer ids of rsa and ecdsa keys do not embed the key, so are accepted as is
+func recipientID(recipient string) (string, error) {
+	if id, err := peer.Decode(recipient); err == nil {
+		return id.Pretty(), nil
+	}
+	pub, err := ParsePublicKey(recipient)
+	if err != nil {
+		return "", err
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return id.Pretty(), nil
+}
+
+// wrapDataKey encrypts the data key so that only the holder of the private key of pub
+// can recover it. rsa keys use rsa-oaep, while elliptic curve keys use an ephemeral
+// diffie-hellman exchange, with the shared secret used to derive an aes-gcm key
+func wrapDataKey(pub ci.PubKey, dataKey []byte) (KeyRecipient, error) {
+	raw, err := pub.Raw()
+	if err != nil {
+		return KeyRecipient{}, err
+	}
+	switch k := pub.(type) {
+	case *ci.RsaPublicKey:
+		rsaPub, err := x509.ParsePKIXPublicKey(raw)
+		if err != nil {
+			return KeyRecipient{}, err
+		}
+		wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaPub.(*rsa.PublicKey), dataKey, []byte(keyWrapInfo))
+		if err != nil {
+			return KeyRecipient{}, err
+		}
+		return KeyRecipient{WrappedKey: wrapped}, nil
+	case *ci.Ed25519PublicKey:
+		point, err := ed25519PublicToX25519(raw)
+		if err != nil {
+			return KeyRecipient{}, err
+		}
+		var ephemeral, ephemeralPub [32]byte
+		if _, err := rand.Read(ephemeral[:]); err != nil {
+			return KeyRecipient{}, err
+		}
+		curve25519.ScalarBaseMult(&ephemeralPub, &ephemeral)
+		shared, err := x25519(ephemeral[:], point)
+		if err != nil {
+			return KeyRecipient{}, err
+		}
+		return sealDataKey(shared, ephemeralPub[:], raw, dataKey)
+	case *ci.ECDSAPublicKey, *ci.Secp256k1PublicKey:
+		ecPub, err := ecdsaPublicKey(k)
+		if err != nil {
+			return KeyRecipient{}, err
+		}
+		ephemeral, x, y, err := elliptic.GenerateKey(ecPub.Curve, rand.Reader)
+		if err != nil {
+			return KeyRecipient{}, err
+		}
+		sharedX, _ := ecPub.Curve.ScalarMult(ecPub.X, ecPub.Y, ephemeral)
+		shared := sharedX.FillBytes(make([]byte, (ecPub.Curve.Params().BitSize+7)/8))
+		return sealDataKey(shared, elliptic.Marshal(ecPub.Curve, x, y), raw, dataKey)
+	default:
+		return KeyRecipient{}, errors.New("unsupported key type")
+	}
+}
+
+// unwrapDataKey recovers a data key wrapped by wrapDataKey
+func unwrapDataKey(pk ci.PrivKey, recipient KeyRecipient) ([]byte, error) {
+	raw, err := pk.Raw()
+	if err != nil {
+		return nil, err
+	}
+	pubRaw, err := pk.GetPublic().Raw()
+	if err != nil {
+		return nil, err
+	}
+	switch k := pk.(type) {
+	case *ci.RsaPrivateKey:
+		rsaPriv, err := x509.ParsePKCS1PrivateKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		return rsa.DecryptOAEP(sha256.New(), rand.Reader, rsaPriv, recipient.WrappedKey, []byte(keyWrapInfo))
+	case *ci.Ed25519PrivateKey:
+		// the x25519 scalar of an ed25519 key is the first half of the hashed seed
+		digest := sha512.Sum512(raw[:32])
+		shared, err := x25519(digest[:32], recipient.EphemeralKey)
+		if err != nil {
+			return nil, err
+		}
+		return openDataKey(shared, recipient.EphemeralKey, pubRaw, recipient.WrappedKey)
+	case *ci.ECDSAPrivateKey, *ci.Secp256k1PrivateKey:
+		ecPriv, err := ecdsaPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		x, y := elliptic.Unmarshal(ecPriv.Curve, recipient.EphemeralKey)
+		if x == nil {
+			return nil, errors.New("invalid ephemeral key")
+		}
+		sharedX, _ := ecPriv.Curve.ScalarMult(x, y, ecPriv.D.Bytes())
+		shared := sharedX.FillBytes(make([]byte, (ecPriv.Curve.Params().BitSize+7)/8))
+		return openDataKey(shared, recipient.EphemeralKey, pubRaw, recipient.WrappedKey)
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+}
+
+// keyWrapAEAD derives the aead used to wrap a data key from a diffie-hellman
+// shared secret, bound to both the ephemeral and recipient public keys
+func keyWrapAEAD(shared, ephemeralPub, recipientPub []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte{}, ephemeralPub...), recipientPub...)
+	kek := make([]byte, encryptionKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(keyWrapInfo)), kek); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealDataKey wraps a data key. Every ephemeral key is used once, so a zero nonce is safe
+func sealDataKey(shared, ephemeralPub, recipientPub, dataKey []byte) (KeyRecipient, error) {
+	aead, err := keyWrapAEAD(shared, ephemeralPub, recipientPub)
+	if err != nil {
+		return KeyRecipient{}, err
+	}
+	return KeyRecipient{
+		EphemeralKey: ephemeralPub,
+		WrappedKey:   aead.Seal(nil, make([]byte, aead.NonceSize()), dataKey, nil),
+	}, nil
+}
+
+func openDataKey(shared, ephemeralPub, recipientPub, wrapped []byte) ([]byte, error) {
+	aead, err := keyWrapAEAD(shared, ephemeralPub, recipientPub)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := aead.Open(nil, make([]byte, aead.NonceSize()), wrapped, nil)
+	if err != nil {
+		return nil, errors.New("failed to unwrap data key")
+	}
+	return dataKey, nil
+}
+
+// ed25519PublicToX25519 converts an ed25519 public key to the equivalent x25519
+// public key, using the birational map u = (1 + y) / (1 - y) between the curves
+func ed25519PublicToX25519(pub []byte) ([]byte, error) {
+	if len(pub) != 32 {
+		return nil, errors.New("invalid ed25519 public key")
+	}
+	p := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	le := append([]byte{}, pub...)
+	le[31] &= 0x7f
+	y := new(big.Int).SetBytes(reverse(le))
+	denominator := new(big.Int).Sub(big.NewInt(1), y)
+	denominator.Mod(denominator, p)
+	if denominator.Sign() == 0 {
+		return nil, errors.New("invalid ed25519 public key")
+	}
+	u := new(big.Int).Add(big.NewInt(1), y)
+	u.Mul(u, denominator.ModInverse(denominator, p))
+	u.Mod(u, p)
+	return reverse(u.FillBytes(make([]byte, 32))), nil
+}
+
+// x25519 performs an x25519 exchange, rejecting low order points
+func x25519(scalar, point []byte) ([]byte, error) {
+	if len(scalar) != 32 || len(point) != 32 {
+		return nil, errors.New("invalid x25519 key")
+	}
+	var dst, in, base [32]byte
+	copy(in[:], scalar)
+	copy(base[:], point)
+	curve25519.ScalarMult(&dst, &in, &base)
+	if bytes.Equal(dst[:], make([]byte, 32)) {
+		return nil, errors.New("invalid x25519 public key")
+	}
+	return dst[:], nil
+}
+
+func ecdsaPublicKey(pub ci.PubKey) (*ecdsa.PublicKey, error) {
+	if k, ok := pub.(*ci.Secp256k1PublicKey); ok {
+		return (*ecdsa.PublicKey)(k), nil
+	}
+	raw, err := pub.Raw()
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	ecPub, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an ecdsa key")
+	}
+	return ecPub, nil
+}
+
+func ecdsaPrivateKey(pk ci.PrivKey) (*ecdsa.PrivateKey, error) {
+	if k, ok := pk.(*ci.Secp256k1PrivateKey); ok {
+		return (*ecdsa.PrivateKey)(k), nil
+	}
+	raw, err := pk.Raw()
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseECPrivateKey(raw)
+}
+
+func reverse(b []byte) []byte {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b
+}
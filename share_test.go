@@ -0,0 +1,179 @@
+package rtfs_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/RTradeLtd/rtfs/v2"
+	"github.com/RTradeLtd/rtfs/v2/rtfstest"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestShare(t *testing.T) {
+	const plaintext = "hello world, this content is shared"
+	km := newTestKeystoreManager(t)
+	ids := make(map[string]string)
+	for _, key := range []struct {
+		name    string
+		keyType int
+		bits    int
+	}{
+		{"owner", rtfs.KeyTypeEd25519, 256},
+		{"bob", rtfs.KeyTypeSecp256k1, 256},
+		{"carol", rtfs.KeyTypeECDSA, 256},
+		{"dave", rtfs.KeyTypeRSA, 2048},
+		{"eve", rtfs.KeyTypeEd25519, 256},
+	} {
+		pk, err := km.CreateAndSaveKey(key.name, key.keyType, key.bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key.keyType == rtfs.KeyTypeRSA || key.keyType == rtfs.KeyTypeECDSA {
+			// rsa and ecdsa peer ids do not embed the public key
+			pubBytes, err := ci.MarshalPublicKey(pk.GetPublic())
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids[key.name] = base64.StdEncoding.EncodeToString(pubBytes)
+			continue
+		}
+		id, err := peer.IDFromPrivateKey(pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[key.name] = id.Pretty()
+	}
+	node := rtfstest.NewNode()
+	canRead := func(t *testing.T, envelope string, want map[string]bool) {
+		t.Helper()
+		for name, wantRead := range want {
+			data, err := km.CatShared(name, envelope, ids["owner"], node)
+			if (err == nil) != wantRead {
+				t.Fatalf("CatShared(%s) err = %v, want read %v", name, err, wantRead)
+			}
+			if wantRead && string(data) != plaintext {
+				t.Fatalf("CatShared(%s) = %s, want %s", name, data, plaintext)
+			}
+		}
+	}
+
+	first, err := km.AddShared("owner", strings.NewReader(plaintext), rtfs.EncryptOpts{},
+		[]string{ids["bob"], ids["carol"], ids["dave"]}, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	canRead(t, first, map[string]bool{"owner": true, "bob": true, "carol": true, "dave": true, "eve": false})
+
+	granted, err := km.GrantAccess("owner", first, []string{ids["eve"], ids["carol"]}, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	canRead(t, granted, map[string]bool{"owner": true, "bob": true, "carol": true, "dave": true, "eve": true})
+	canRead(t, first, map[string]bool{"eve": false})
+	if _, err := km.GrantAccess("bob", first, []string{ids["eve"]}, node); err == nil {
+		t.Fatal("expected error granting access without being the owner")
+	}
+
+	revoked, err := km.RevokeAccess("owner", granted, []string{ids["bob"], ids["dave"]}, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	canRead(t, revoked, map[string]bool{"owner": true, "bob": false, "carol": true, "dave": false, "eve": true})
+
+	if adds := len(node.Calls("Add")); adds != 1 {
+		t.Fatalf("content was added %v times, want 1", adds)
+	}
+	firstEnv, err := rtfs.GetKeyEnvelope(first, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedEnv, err := rtfs.GetKeyEnvelope(revoked, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revokedEnv.Content.Equals(firstEnv.Content) {
+		t.Fatal("content changed between envelopes")
+	}
+	if revokedEnv.Owner != ids["owner"] {
+		t.Fatalf("owner = %s, want %s", revokedEnv.Owner, ids["owner"])
+	}
+	if len(revokedEnv.Recipients) != 3 {
+		t.Fatalf("envelope has %v recipients, want 3", len(revokedEnv.Recipients))
+	}
+
+	if _, err := km.RevokeAccess("owner", revoked, []string{ids["bob"]}, node); err == nil {
+		t.Fatal("expected error revoking a non-recipient")
+	}
+	if _, err := km.RevokeAccess("owner", revoked, []string{ids["owner"]}, node); err == nil {
+		t.Fatal("expected error revoking the owner")
+	}
+	if _, err := km.RevokeAccess("carol", revoked, []string{ids["eve"]}, node); err == nil {
+		t.Fatal("expected error revoking access without being the owner")
+	}
+	// content shared by another key is only read when that key is expected
+	forged, err := km.AddShared("eve", strings.NewReader(plaintext), rtfs.EncryptOpts{}, []string{ids["bob"]}, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := km.CatShared("bob", forged, ids["owner"], node); err == nil {
+		t.Fatal("expected error reading an envelope not signed by the owner")
+	}
+	if data, err := km.CatShared("bob", forged, ids["eve"], node); err != nil || string(data) != plaintext {
+		t.Fatalf("CatShared() = %s, %v, want %s", data, err, plaintext)
+	}
+	if _, err := km.CatShared("bob", forged, "bad", node); err == nil {
+		t.Fatal("expected error for invalid owner")
+	}
+	if _, err := km.AddShared("owner", strings.NewReader(plaintext), rtfs.EncryptOpts{}, []string{"bad"}, node); err == nil {
+		t.Fatal("expected error for invalid recipient")
+	}
+}
+
+func TestGetKeyEnvelope_Unsigned(t *testing.T) {
+	km := newTestKeystoreManager(t)
+	pk, err := km.CreateAndSaveKey("owner", rtfs.KeyTypeEd25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := rtfstest.NewNode()
+	hash, err := km.AddShared("owner", strings.NewReader("hello"), rtfs.EncryptOpts{}, nil, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := rtfs.GetKeyEnvelope(hash, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a recipient added without the owner's signature is rejected
+	forged := *env
+	forged.Recipients = append(append([]rtfs.KeyRecipient{}, env.Recipients...), rtfs.KeyRecipient{ID: id.Pretty(), WrappedKey: []byte("key")})
+	unsigned := *env
+	unsigned.Signature = nil
+	tests := []struct {
+		name string
+		env  rtfs.KeyEnvelope
+	}{
+		{"Forged", forged},
+		{"Unsigned", unsigned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := rtfs.PutKeyEnvelope(&tt.env, node); err == nil {
+				t.Fatal("PutKeyEnvelope() err = nil, wantErr true")
+			}
+			hash, err := node.DagPutWithOptions(tt.env, rtfs.DagPutOpts{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rtfs.GetKeyEnvelope(hash, node); err == nil {
+				t.Fatal("GetKeyEnvelope() err = nil, wantErr true")
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package rtfs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// cidSignaturePrefix is prepended to all signed cid statements so that a
+// cid signature can never be confused with a signature over arbitrary data
+const cidSignaturePrefix = "rtfs-cid-signature"
+
+// CIDSignature is a detached signature stating that the signer vouches for a CID.
+// It is JSON encoded, and can be stored as an ipld object with PutCIDSignature
+type CIDSignature struct {
+	CID       string `json:"cid"`
+	Signer    string `json:"signer"`
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Sign is used to sign data with the named key
+func (km *KeystoreManager) Sign(keyName string, data []byte) ([]byte, error) {
+	pk, err := km.GetPrivateKeyByName(keyName)
+	if err != nil {
+		return nil, err
+	}
+	return pk.Sign(data)
+}
+
+// Verify is used to verify a signature over data. The signer may be given as a
+// peer ID with an embedded public key, or a base64 encoded public key
+func (km *KeystoreManager) Verify(peerIDorPubKey string, data, sig []byte) (bool, error) {
+	pub, err := ParsePublicKey(peerIDorPubKey)
+	if err != nil {
+		return false, err
+	}
+	return pub.Verify(data, sig)
+}
+
+// SignCID is used to create a detached signature stating that the named key vouches for the given cid
+func (km *KeystoreManager) SignCID(keyName, cid string) (*CIDSignature, error) {
+	pk, err := km.GetPrivateKeyByName(keyName)
+	if err != nil {
+		return nil, err
+	}
+	id, err := peer.IDFromPrivateKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	pubBytes, err := pk.GetPublic().Bytes()
+	if err != nil {
+		return nil, err
+	}
+	cs := &CIDSignature{
+		CID:       cid,
+		Signer:    id.Pretty(),
+		PublicKey: pubBytes,
+		Timestamp: time.Now().Unix(),
+	}
+	if cs.Signature, err = pk.Sign(cs.statement()); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// Verify is used to check that the signature is valid, and
+// was produced by the key belonging to the signer
+func (cs *CIDSignature) Verify() error {
+	pub, err := ci.UnmarshalPublicKey(cs.PublicKey)
+	if err != nil {
+		return err
+	}
+	id, err := peer.Decode(cs.Signer)
+	if err != nil {
+		return err
+	}
+	if !id.MatchesPublicKey(pub) {
+		return errors.New("public key does not match signer")
+	}
+	valid, err := pub.Verify(cs.statement(), cs.Signature)
+	if err != nil {
+		return err
+	} else if !valid {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// statement returns the bytes that are signed
+func (cs *CIDSignature) statement() []byte {
+	return []byte(fmt.Sprintf("%s\n%s\n%s\n%d", cidSignaturePrefix, cs.Signer, cs.CID, cs.Timestamp))
+}
+
+// ParsePublicKey is used to parse a public key from either a peer ID
+// with an embedded public key, or a base64 encoded public key
+func ParsePublicKey(peerIDorPubKey string) (ci.PubKey, error) {
+	if id, err := peer.Decode(peerIDorPubKey); err == nil {
+		pub, err := id.ExtractPublicKey()
+		if err != nil {
+			return nil, err
+		} else if pub == nil {
+			return nil, errors.New("peer id does not embed a public key")
+		}
+		return pub, nil
+	}
+	pubBytes, err := base64.StdEncoding.DecodeString(peerIDorPubKey)
+	if err != nil {
+		return nil, errors.New("input is neither a peer id or base64 encoded public key")
+	}
+	return ci.UnmarshalPublicKey(pubBytes)
+}
+
+// PutCIDSignature is used to store a cid signature as an ipld object
+func PutCIDSignature(sig *CIDSignature, im Manager) (string, error) {
+	data, err := json.Marshal(sig)
+	if err != nil {
+		return "", err
+	}
+	return im.DagPut(data, "json", "cbor")
+}
+
+// GetCIDSignature is used to retrieve and verify a cid signature stored with PutCIDSignature
+func GetCIDSignature(hash string, im Manager) (*CIDSignature, error) {
+	var sig CIDSignature
+	if err := im.DagGet(hash, &sig); err != nil {
+		return nil, err
+	}
+	if err := sig.Verify(); err != nil {
+		return nil, err
+	}
+	return &sig, nil
+}
@@ -0,0 +1,101 @@
+package rtfs_test
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/rtfs/v2"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	km := newTestKeystoreManager(t)
+	tests := []struct {
+		name    string
+		keyType int
+		bits    int
+	}{
+		{"RSA", rtfs.KeyTypeRSA, 2048},
+		{"Ed25519", rtfs.KeyTypeEd25519, 0},
+		{"Secp256k1", rtfs.KeyTypeSecp256k1, 0},
+		{"ECDSA", rtfs.KeyTypeECDSA, 0},
+	}
+	data := []byte("hello world")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pk, err := km.CreateAndSaveKey(tt.name, tt.keyType, tt.bits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, err := km.Sign(tt.name, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pubBytes, err := pk.GetPublic().Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			signers := []string{base64.StdEncoding.EncodeToString(pubBytes)}
+			// rsa and ecdsa keys are too large to be embedded in a peer id
+			if tt.keyType == rtfs.KeyTypeEd25519 || tt.keyType == rtfs.KeyTypeSecp256k1 {
+				id, err := peer.IDFromPrivateKey(pk)
+				if err != nil {
+					t.Fatal(err)
+				}
+				signers = append(signers, id.Pretty())
+			}
+			for _, signer := range signers {
+				if valid, err := km.Verify(signer, data, sig); err != nil {
+					t.Fatal(err)
+				} else if !valid {
+					t.Fatal("failed to verify signature")
+				}
+				if valid, _ := km.Verify(signer, []byte("goodbye world"), sig); valid {
+					t.Fatal("verified signature over the wrong data")
+				}
+			}
+			cs, err := km.SignCID(tt.name, testPIN)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cs.Verify(); err != nil {
+				t.Fatal(err)
+			}
+			cs.CID = testRefsHash
+			if err := cs.Verify(); err == nil {
+				t.Fatal("verified signature over the wrong cid")
+			}
+		})
+	}
+	if _, err := km.Verify("notapeeridorkey", data, nil); err == nil {
+		t.Fatal("expected error parsing invalid signer")
+	}
+}
+
+func TestCIDSignature_DagPut(t *testing.T) {
+	im, err := rtfs.NewManager(nodeOneAPIAddr, "", time.Minute*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	km := newTestKeystoreManager(t)
+	if _, err := km.CreateAndSaveKey("signer", ci.Ed25519, 256); err != nil {
+		t.Fatal(err)
+	}
+	cs, err := km.SignCID("signer", testPIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := rtfs.PutCIDSignature(cs, im)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := rtfs.GetCIDSignature(hash, im)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered.CID != testPIN || recovered.Signer != cs.Signer {
+		t.Fatal("recovered signature does not match")
+	}
+}
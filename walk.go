@@ -0,0 +1,196 @@
+package rtfs
+
+import (
+	"context"
+	"errors"
+)
+
+// traversal orders
+const (
+	// WalkBFS visits every object at one depth before moving to the next
+	WalkBFS = iota
+	// WalkDFS visits the whole subtree under an object before its next sibling
+	WalkDFS
+)
+
+// WalkEntry is an object reached while walking a dag
+type WalkEntry struct {
+	// Parent is the object linking to this one, empty for the root
+	Parent string
+	// Name is the name of the link from the parent
+	Name string
+	CID  string
+	// Size is the cumulative size given by the parent link, when known
+	Size uint64
+	// Depth is the number of links followed from the root
+	Depth int
+}
+
+// WalkSelector is used to decide whether or not the subtree under an entry is walked.
+// The entry itself is always visited
+type WalkSelector func(entry WalkEntry) bool
+
+// WalkOpts is used to control a dag walk
+type WalkOpts struct {
+	// Order is either WalkBFS or WalkDFS, defaults to WalkBFS
+	Order int
+	// MaxDepth limits how many links are followed from the root, zero is unlimited
+	MaxDepth int
+	// Selector skips the subtrees it returns false for, when set
+	Selector WalkSelector
+	// Concurrency is the number of objects whose links are fetched ahead
+	// of the walk, defaults to one. Entries are always visited in order
+	Concurrency int
+}
+
+// Walker is used to iterate over the objects of a dag. Links are fetched lazily,
+// so only as much of the dag as is iterated over is retrieved
+type Walker struct {
+	ctx     context.Context
+	im      Manager
+	opts    WalkOpts
+	pending []*walkNode
+	current *walkNode
+	err     error
+}
+
+type walkNode struct {
+	entry  WalkEntry
+	expand bool
+	links  chan walkLinks
+}
+
+type walkLinks struct {
+	links []DagLink
+	err   error
+}
+
+// NewWalker is used to walk the dag under root. Iterate by calling Next until
+// it returns false, then check Err
+func NewWalker(ctx context.Context, im Manager, root string, opts WalkOpts) *Walker {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	w := &Walker{ctx: ctx, im: im, opts: opts}
+	if opts.Order != WalkBFS && opts.Order != WalkDFS {
+		w.err = errors.New("invalid walk order")
+		return w
+	}
+	w.push(w.newNode(WalkEntry{CID: root}))
+	return w
+}
+
+// Next advances to the next entry, returning false once the walk is
+// complete or has failed
+func (w *Walker) Next() bool {
+	if w.err != nil {
+		return false
+	}
+	if err := w.ctx.Err(); err != nil {
+		w.err = err
+		return false
+	}
+	// the children of the last entry are only queued once the caller has moved past it
+	if w.current != nil && w.current.expand {
+		var result walkLinks
+		select {
+		case result = <-w.current.links:
+		case <-w.ctx.Done():
+			w.err = w.ctx.Err()
+			return false
+		}
+		if result.err != nil {
+			w.err = result.err
+			return false
+		}
+		children := make([]*walkNode, 0, len(result.links))
+		for _, link := range result.links {
+			children = append(children, w.newNode(WalkEntry{
+				Parent: w.current.entry.CID,
+				Name:   link.Name,
+				CID:    link.Hash,
+				Size:   link.Size,
+				Depth:  w.current.entry.Depth + 1,
+			}))
+		}
+		w.push(children...)
+	}
+	w.current = nil
+	if len(w.pending) == 0 {
+		return false
+	}
+	if w.opts.Order == WalkBFS {
+		w.current, w.pending = w.pending[0], w.pending[1:]
+	} else {
+		last := len(w.pending) - 1
+		w.current, w.pending = w.pending[last], w.pending[:last]
+	}
+	w.prefetch()
+	return true
+}
+
+// Entry returns the current entry
+func (w *Walker) Entry() WalkEntry {
+	if w.current == nil {
+		return WalkEntry{}
+	}
+	return w.current.entry
+}
+
+// Err returns the error that stopped the walk, if any
+func (w *Walker) Err() error {
+	return w.err
+}
+
+// WalkDag is used to collect every entry of a walk
+func WalkDag(ctx context.Context, im Manager, root string, opts WalkOpts) ([]WalkEntry, error) {
+	var entries []WalkEntry
+	w := NewWalker(ctx, im, root, opts)
+	for w.Next() {
+		entries = append(entries, w.Entry())
+	}
+	return entries, w.Err()
+}
+
+func (w *Walker) newNode(entry WalkEntry) *walkNode {
+	expand := w.opts.MaxDepth <= 0 || entry.Depth < w.opts.MaxDepth
+	if expand && w.opts.Selector != nil {
+		expand = w.opts.Selector(entry)
+	}
+	return &walkNode{entry: entry, expand: expand}
+}
+
+// push queues nodes so they are visited in the order given
+func (w *Walker) push(nodes ...*walkNode) {
+	if w.opts.Order == WalkBFS {
+		w.pending = append(w.pending, nodes...)
+		return
+	}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		w.pending = append(w.pending, nodes[i])
+	}
+}
+
+// prefetch starts fetching the links of the current node, and of
+// the nodes that will be visited next, up to the concurrency limit
+func (w *Walker) prefetch() {
+	w.fetch(w.current)
+	for i := 0; i < len(w.pending) && i < w.opts.Concurrency-1; i++ {
+		if w.opts.Order == WalkBFS {
+			w.fetch(w.pending[i])
+		} else {
+			w.fetch(w.pending[len(w.pending)-1-i])
+		}
+	}
+}
+
+func (w *Walker) fetch(node *walkNode) {
+	if !node.expand || node.links != nil {
+		return
+	}
+	node.links = make(chan walkLinks, 1)
+	go func() {
+		links, err := w.im.DagLinks(node.entry.CID)
+		node.links <- walkLinks{links: links, err: err}
+	}()
+}
@@ -0,0 +1,97 @@
+package rtfs_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/rtfs/v2"
+	"github.com/RTradeLtd/rtfs/v2/rtfstest"
+)
+
+// newFakeDagNode returns a node holding a small dag rooted at "root"
+func newFakeDagNode() *rtfstest.Node {
+	node := rtfstest.NewNode()
+	for hash, links := range map[string][]rtfs.DagLink{
+		"root": {{Name: "a", Hash: "a", Size: 10}, {Name: "b", Hash: "b", Size: 20}},
+		"a":    {{Name: "a1", Hash: "a1", Size: 4}, {Name: "a2", Hash: "a2", Size: 5}},
+		"b":    {{Name: "b1", Hash: "b1", Size: 6}},
+		"b1":   {{Name: "b1x", Hash: "b1x", Size: 1}},
+		"a1":   nil,
+		"a2":   nil,
+		"b1x":  nil,
+	} {
+		node.SetLinks(hash, links)
+	}
+	return node
+}
+
+func TestWalker(t *testing.T) {
+	tests := []struct {
+		name string
+		opts rtfs.WalkOpts
+		want []string
+	}{
+		{"BFS", rtfs.WalkOpts{Order: rtfs.WalkBFS}, []string{"root", "a", "b", "a1", "a2", "b1", "b1x"}},
+		{"DFS", rtfs.WalkOpts{Order: rtfs.WalkDFS}, []string{"root", "a", "a1", "a2", "b", "b1", "b1x"}},
+		{"Max-Depth", rtfs.WalkOpts{MaxDepth: 1}, []string{"root", "a", "b"}},
+		{"Selector", rtfs.WalkOpts{Order: rtfs.WalkDFS, Selector: func(entry rtfs.WalkEntry) bool {
+			return entry.Name != "a"
+		}}, []string{"root", "a", "b", "b1", "b1x"}},
+		{"Concurrent", rtfs.WalkOpts{Order: rtfs.WalkDFS, Concurrency: 4}, []string{"root", "a", "a1", "a2", "b", "b1", "b1x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newFakeDagNode()
+			entries, err := rtfs.WalkDag(context.Background(), node, "root", tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("WalkDag() returned %v entries, want %v", len(entries), len(tt.want))
+			}
+			for i, entry := range entries {
+				if entry.CID != tt.want[i] {
+					t.Fatalf("entry %v = %v, want %v", i, entry.CID, tt.want[i])
+				}
+			}
+			if tt.opts.Selector != nil {
+				for _, hash := range node.Calls("DagLinks") {
+					if hash == "a" {
+						t.Fatal("fetched links of skipped subtree")
+					}
+				}
+			}
+		})
+	}
+	entries, err := rtfs.WalkDag(context.Background(), newFakeDagNode(), "root", rtfs.WalkOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b1x := entries[6]; b1x.Parent != "b1" || b1x.Name != "b1x" || b1x.Size != 1 || b1x.Depth != 3 {
+		t.Fatalf("bad entry %+v", b1x)
+	}
+}
+
+func TestWalker_Errors(t *testing.T) {
+	node := newFakeDagNode()
+	node.SetLinks("a", []rtfs.DagLink{{Name: "broken", Hash: "broken"}})
+	w := rtfs.NewWalker(context.Background(), node, "root", rtfs.WalkOpts{Order: rtfs.WalkDFS})
+	var visited []string
+	for w.Next() {
+		visited = append(visited, w.Entry().CID)
+	}
+	// the broken entry is visited, but its links can not be fetched
+	if w.Err() == nil || len(visited) != 3 || visited[2] != "broken" {
+		t.Fatalf("Walker visited %v, err = %v", visited, w.Err())
+	}
+	if _, err := rtfs.WalkDag(context.Background(), node, "root", rtfs.WalkOpts{Order: 5}); err == nil {
+		t.Fatal("expected error for invalid order")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if _, err := rtfs.WalkDag(ctx, node, "root", rtfs.WalkOpts{}); err != context.DeadlineExceeded {
+		t.Fatalf("WalkDag() err = %v, want deadline exceeded", err)
+	}
+}